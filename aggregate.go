@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// metricExpr matches aggregate metric expressions, e.g. count(*) or max(age)
+var metricExpr = regexp.MustCompile(`^(count|count_distinct|sum|avg|min|max)\(\s*(\*|[a-zA-Z0-9_.]+)\s*\)$`)
+
+// Aggregate describes an in-process aggregation of result rows, producing a
+// row per distinct combination of group_by column values
+type Aggregate struct {
+	GroupBy []string          `json:"group_by"`
+	Metrics map[string]string `json:"metrics" validate:"required,min=1"`
+}
+
+// metric describes a parsed aggregate metric expression
+type metric struct {
+	name   string
+	fn     string
+	column string
+}
+
+// parseMetrics parses the configured metric expressions, where "*" is
+// shorthand for count(*)
+func parseMetrics(a *Aggregate) ([]metric, error) {
+	metrics := make([]metric, 0, len(a.Metrics))
+	for name, expr := range a.Metrics {
+		expr = strings.TrimSpace(expr)
+		if expr == "*" {
+			expr = "count(*)"
+		}
+		m := metricExpr.FindStringSubmatch(strings.ToLower(expr))
+		if m == nil {
+			return nil, fmt.Errorf("invalid aggregate metric '%s': unsupported expression '%s'", name, expr)
+		}
+		if m[2] == "*" && m[1] != "count" {
+			return nil, fmt.Errorf("invalid aggregate metric '%s': %s does not support '*'", name, m[1])
+		}
+		metrics = append(metrics, metric{name: name, fn: m[1], column: m[2]})
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+	return metrics, nil
+}
+
+// aggregateRows groups rows by the configured group_by columns and computes
+// the configured metrics for each group, returning groups ordered by their
+// group_by values for stable versions
+func aggregateRows(s *Source, rows []interface{}) ([]interface{}, error) {
+	metrics, err := parseMetrics(s.Aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		key    string
+		values map[string]interface{}
+		rows   []gjson.Result
+	}
+	groups := make(map[string]*group)
+	for _, row := range rows {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing row for aggregation: %v", err)
+		}
+		parsed := gjson.ParseBytes(b)
+
+		values := make(map[string]interface{}, len(s.Aggregate.GroupBy))
+		var parts []string
+		for _, col := range s.Aggregate.GroupBy {
+			v := parsed.Get(col)
+			values[col] = v.Value()
+			parts = append(parts, v.Raw)
+		}
+		key := strings.Join(parts, "\x00")
+		g, ok := groups[key]
+		if !ok {
+			g = &group{key: key, values: values}
+			groups[key] = g
+		}
+		g.rows = append(g.rows, parsed)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]interface{}, 0, len(groups))
+	for _, key := range keys {
+		g := groups[key]
+		out := make(map[string]interface{}, len(g.values)+len(metrics))
+		for k, v := range g.values {
+			out[k] = v
+		}
+		for _, m := range metrics {
+			if out[m.name], err = m.compute(g.rows); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// compute evaluates the metric against the rows of a group, ignoring null
+// values, where min and max compare numbers numerically and all other values
+// (e.g. RFC3339 timestamps) lexically
+func (m metric) compute(rows []gjson.Result) (interface{}, error) {
+	if m.column == "*" {
+		return len(rows), nil
+	}
+
+	var values []gjson.Result
+	for _, row := range rows {
+		if v := row.Get(m.column); v.Exists() && v.Type != gjson.Null {
+			values = append(values, v)
+		}
+	}
+
+	switch m.fn {
+	case "count":
+		return len(values), nil
+	case "count_distinct":
+		seen := make(map[string]bool, len(values))
+		for _, v := range values {
+			seen[v.Raw] = true
+		}
+		return len(seen), nil
+	case "sum", "avg":
+		var sum float64
+		for _, v := range values {
+			if v.Type != gjson.Number {
+				return nil, fmt.Errorf("error computing aggregate metric '%s': column '%s' is not numeric: %s", m.name, m.column, v.Raw)
+			}
+			sum += v.Float()
+		}
+		if m.fn == "sum" {
+			return sum, nil
+		}
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return sum / float64(len(values)), nil
+	default:
+		if len(values) == 0 {
+			return nil, nil
+		}
+		best := values[0]
+		for _, v := range values[1:] {
+			less := v.String() < best.String()
+			if v.Type == gjson.Number && best.Type == gjson.Number {
+				less = v.Float() < best.Float()
+			}
+			if less == (m.fn == "min") && v.Raw != best.Raw {
+				best = v
+			}
+		}
+		return best.Value(), nil
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAggregateRows(t *testing.T) {
+	rows := `[
+  {"region": "us-east-1", "owner": "a", "size": 10, "created": "2024-01-02T00:00:00Z", "tag": "x"},
+  {"region": "us-west-2", "owner": "b", "size": 5, "created": "2024-01-03T00:00:00Z", "tag": null},
+  {"region": "us-east-1", "owner": "a", "size": 2, "created": "2024-01-01T00:00:00Z"},
+  {"region": "us-east-1", "owner": "c", "size": 9, "created": "2024-01-04T00:00:00Z", "tag": "y"}
+]`
+
+	cases := []struct {
+		name      string
+		aggregate Aggregate
+		rows      string
+		want      string
+		err       string
+	}{
+		{
+			name: "grouped metrics",
+			aggregate: Aggregate{
+				GroupBy: []string{"region"},
+				Metrics: map[string]string{
+					"avg_size":  "avg(size)",
+					"first":     "min(created)",
+					"largest":   "max(size)",
+					"owners":    "count_distinct(owner)",
+					"resources": "*",
+					"tagged":    "count(tag)",
+					"total":     "SUM(size)",
+				},
+			},
+			rows: rows,
+			want: `[{"avg_size":7,"first":"2024-01-01T00:00:00Z","largest":10,"owners":2,"region":"us-east-1","resources":3,"tagged":2,"total":21},` +
+				`{"avg_size":5,"first":"2024-01-03T00:00:00Z","largest":5,"owners":1,"region":"us-west-2","resources":1,"tagged":0,"total":5}]`,
+		},
+		{
+			name:      "ungrouped",
+			aggregate: Aggregate{Metrics: map[string]string{"resources": "count(*)", "smallest": "min(size)"}},
+			rows:      rows,
+			want:      `[{"resources":4,"smallest":2}]`,
+		},
+		{
+			name:      "null metrics",
+			aggregate: Aggregate{Metrics: map[string]string{"avg": "avg(missing)", "max": "max(missing)", "sum": "sum(missing)"}},
+			rows:      `[{"id": "a"}]`,
+			want:      `[{"avg":null,"max":null,"sum":0}]`,
+		},
+		{
+			name:      "no rows",
+			aggregate: Aggregate{GroupBy: []string{"region"}, Metrics: map[string]string{"resources": "*"}},
+			rows:      `[]`,
+			want:      `[]`,
+		},
+		{
+			name:      "unsupported expression",
+			aggregate: Aggregate{Metrics: map[string]string{"p99": "percentile(size, 99)"}},
+			rows:      rows,
+			err:       "invalid aggregate metric 'p99': unsupported expression",
+		},
+		{
+			name:      "wildcard",
+			aggregate: Aggregate{Metrics: map[string]string{"total": "sum(*)"}},
+			rows:      rows,
+			err:       "invalid aggregate metric 'total': sum does not support '*'",
+		},
+		{
+			name:      "non-numeric",
+			aggregate: Aggregate{Metrics: map[string]string{"total": "sum(owner)"}},
+			rows:      rows,
+			err:       "column 'owner' is not numeric",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var in []interface{}
+			if err := json.Unmarshal([]byte(c.rows), &in); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := aggregateRows(&Source{Aggregate: &c.aggregate}, in)
+			switch {
+			case c.err != "":
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing '%s', got %v", c.err, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := json.Marshal(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Fatalf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/cludden/concourse-go-sdk/pkg/archive"
+	s3archive "github.com/hashicorp/concourse-steampipe-resource/internal/archive"
+)
+
+// ArchiveConfig describes the resource version archive, which is either one
+// of the sdk archive backends (boltdb or inmem) or an s3 object archive
+type ArchiveConfig struct {
+	archive.Config
+	Debug      bool                `json:"debug"`
+	Keep       int                 `json:"keep" validate:"gte=0"`
+	LatestOnly bool                `json:"latest_only"`
+	S3         *s3archive.S3Config `json:"s3" validate:"omitempty"`
+}
+
+// validate verifies that a single archive backend is configured, and that
+// the backend supports the configured retention
+func (c *ArchiveConfig) validate() error {
+	if c.S3 != nil && (c.BoltDB != nil || c.Inmem != nil) {
+		return fmt.Errorf("archive.s3 cannot be combined with archive.boltdb or archive.inmem")
+	}
+	if c.Keep > 0 && c.S3 == nil {
+		return fmt.Errorf("archive.keep requires archive.s3, as the boltdb and inmem backends cannot prune archived versions")
+	}
+	return nil
+}
+
+// open initializes the configured archive backend, where raw reads and writes
+// objects as stored by the s3 archive, including its envelope
+func (c *ArchiveConfig) open(ctx context.Context, s *Source, raw bool) (sdk.Archive, error) {
+	if c.S3 == nil {
+		a, err := archive.New(ctx, c.Config)
+		if err != nil {
+			return nil, err
+		}
+		return &s3archive.Backend{
+			Archive:      &s3archive.SDK{Archive: a},
+			ForceHistory: c.ForceHistory,
+			Keep:         c.Keep,
+			LatestOnly:   c.LatestOnly,
+			Raw:          raw,
+		}, nil
+	}
+
+	hash, err := digest(s)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s3archive.New(ctx, &s3archive.Config{
+		Type:       "s3",
+		Debug:      c.Debug,
+		S3:         c.S3,
+		ConfigHash: hash,
+		Quiet:      s.Quiet,
+	}, s.Debug)
+	if err != nil {
+		return nil, err
+	}
+	return &s3archive.Backend{
+		Archive:      a,
+		ForceHistory: c.ForceHistory,
+		Keep:         c.Keep,
+		LatestOnly:   c.LatestOnly,
+		Raw:          raw,
+	}, nil
+}
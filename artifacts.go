@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+// artifactsPrefix defines the key prefix, relative to the archive database,
+// under which put artifacts are uploaded
+const artifactsPrefix = "artifacts"
+
+// archiveStore returns an object store for the bucket of the boltdb archive,
+// with keys relative to the directory of the archive database
+func archiveStore(ctx context.Context, s *Source, prefix string) (*blob.Store, error) {
+	if s.Archive == nil || s.Archive.BoltDB == nil {
+		return nil, fmt.Errorf("boltdb archive is not configured")
+	}
+
+	a := s.Archive.BoltDB
+	cfg := &blob.Config{
+		Bucket:   a.Bucket,
+		Endpoint: a.Endpoint,
+		Prefix:   path.Join(path.Dir(a.Key), prefix),
+		Region:   a.Region,
+	}
+	if a.Credentials != nil {
+		cfg.Credentials = &blob.Credentials{
+			AccessKey:    a.Credentials.AccessKey,
+			SecretKey:    a.Credentials.SecretKey,
+			SessionToken: a.Credentials.SessionToken,
+		}
+	}
+	return blob.New(ctx, cfg, s.Debug)
+}
+
+// listArtifacts returns the regular files within the given directory, keyed
+// by slash-separated relative path
+func listArtifacts(dir string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	err := filepath.Walk(dir, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing put directory: %v", err)
+	}
+	return files, nil
+}
+
+// uploadArtifacts uploads the files written to the given directory by the
+// step, i.e. those that did not previously exist or have since been modified,
+// alongside the archive database under a prefix derived from the version
+func (r *Resource) uploadArtifacts(ctx context.Context, s *Source, dir string, existing map[string]os.FileInfo, v Version) ([]sdk.Metadata, error) {
+	sum, err := digest(v.Data)
+	if err != nil {
+		return nil, err
+	}
+	prefix := path.Join(artifactsPrefix, sum)
+	store, err := archiveStore(ctx, s, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing artifact store: %v", err)
+	}
+
+	files, err := listArtifacts(dir)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	for name, info := range files {
+		if prev, ok := existing[name]; ok && prev.ModTime().Equal(info.ModTime()) && prev.Size() == info.Size() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading artifact '%s': %v", name, err)
+		}
+		if err := store.Put(ctx, name, b); err != nil {
+			return nil, fmt.Errorf("error uploading artifact '%s': %v", name, err)
+		}
+		n++
+	}
+
+	location := fmt.Sprintf("s3://%s/%s", s.Archive.BoltDB.Bucket, path.Join(path.Dir(s.Archive.BoltDB.Key), prefix))
+	color.Yellow("uploaded %d artifacts to %s", n, location)
+	return []sdk.Metadata{
+		{Name: "artifacts", Value: location},
+		{Name: "artifacts_uploaded", Value: fmt.Sprint(n)},
+	}, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/build"
+)
+
+// auditTimeout defines the maximum duration of writing an audit record, which
+// is independent of the operation context so that aborted operations are
+// still recorded
+const auditTimeout = 30 * time.Second
+
+type (
+	// audit describes the audit trail sink and the hashes recorded alongside
+	// each operation
+	audit struct {
+		configHash string
+		queryHash  string
+		store      *blob.Store
+	}
+
+	// auditRecord describes a single resource operation
+	auditRecord struct {
+		Build      map[string]string `json:"build,omitempty"`
+		ConfigHash string            `json:"config_hash"`
+		Duration   string            `json:"duration"`
+		DurationMS int64             `json:"duration_ms"`
+		Error      string            `json:"error,omitempty"`
+		ErrorClass string            `json:"error_class,omitempty"`
+		Operation  string            `json:"operation"`
+		Outcome    string            `json:"outcome"`
+		QueryHash  string            `json:"query_hash"`
+		Timestamp  string            `json:"timestamp"`
+	}
+)
+
+// initAudit initializes the audit trail sink and computes the configuration
+// and query hashes
+func (r *Resource) initAudit(ctx context.Context, s *Source) (err error) {
+	a := &audit{}
+	if a.configHash, err = digest(s); err != nil {
+		return err
+	}
+	if a.queryHash, err = digest(map[string]interface{}{
+		"benchmark": s.Benchmark,
+		"pipeline":  s.Pipeline,
+		"queries":   s.Queries,
+		"query":     s.Query,
+	}); err != nil {
+		return err
+	}
+	if a.store, err = blob.New(ctx, s.Audit, s.Debug); err != nil {
+		return fmt.Errorf("error initializing audit store: %v", err)
+	}
+	r.audit = a
+	return nil
+}
+
+// writeAudit appends a record of the completed operation to the audit trail,
+// where each record is written to a unique key such that existing records
+// are never overwritten
+func (r *Resource) writeAudit(op sdk.Op, start time.Time, err error) error {
+	if r.audit == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+
+	name := map[sdk.Op]string{sdk.CheckOp: "check", sdk.InOp: "in", sdk.OutOp: "out"}[op]
+	d := time.Since(start)
+	rec := auditRecord{
+		ConfigHash: r.audit.configHash,
+		Duration:   d.Round(time.Millisecond).String(),
+		DurationMS: d.Milliseconds(),
+		Operation:  name,
+		Outcome:    "success",
+		QueryHash:  r.audit.queryHash,
+		Timestamp:  start.UTC().Format(time.RFC3339Nano),
+	}
+	if err != nil {
+		rec.Outcome = "failure"
+		rec.Error = err.Error()
+		r.fmu.Lock()
+		if r.failure != nil {
+			rec.ErrorClass = r.failure.Class
+		}
+		r.fmu.Unlock()
+	}
+	rec.Build = build.Metadata()
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("error serializing audit record: %v", err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("error generating audit record key: %v", err)
+	}
+	key := path.Join(start.UTC().Format("2006/01/02"), fmt.Sprintf("%s-%s-%s.json", start.UTC().Format("20060102T150405.000000000Z"), name, hex.EncodeToString(suffix)))
+	if err := r.audit.store.Put(ctx, key, b); err != nil {
+		return fmt.Errorf("error writing audit record: %v", err)
+	}
+	color.Yellow("wrote audit record: %s (%s)", key, rec.Outcome)
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// AWSProfile describes a named profile rendered to the shared aws config and
+// credentials files
+type AWSProfile struct {
+	AccessKeyID       string            `json:"access_key_id" validate:"required_with=SecretAccessKey"`
+	CredentialProcess string            `json:"credential_process"`
+	CredentialSource  string            `json:"credential_source" validate:"omitempty,oneof=Environment Ec2InstanceMetadata EcsContainer"`
+	DurationSeconds   int               `json:"duration_seconds" validate:"gte=0"`
+	ExternalID        string            `json:"external_id"`
+	Extra             map[string]string `json:"extra"`
+	MFASerial         string            `json:"mfa_serial"`
+	Region            string            `json:"region"`
+	RoleARN           string            `json:"role_arn"`
+	RoleSessionName   string            `json:"role_session_name"`
+	SecretAccessKey   string            `json:"secret_access_key" validate:"required_with=AccessKeyID"`
+	SessionToken      string            `json:"session_token"`
+	SourceProfile     string            `json:"source_profile"`
+	SSOAccountID      string            `json:"sso_account_id"`
+	SSORegion         string            `json:"sso_region"`
+	SSORoleName       string            `json:"sso_role_name"`
+	SSOStartURL       string            `json:"sso_start_url"`
+}
+
+// awsDir returns the directory containing the shared aws config and
+// credentials files
+func awsDir(s *Source) string {
+	return path.Join(homeDir(s), ".aws")
+}
+
+// writeAWSProfiles renders the configured profiles to the shared aws config
+// and credentials files, readable only by the current user
+func writeAWSProfiles(s *Source) error {
+	if err := os.MkdirAll(awsDir(s), 0700); err != nil {
+		return fmt.Errorf("error creating aws directory: %v", err)
+	}
+	config, credentials := renderAWSProfiles(s.AWSProfiles)
+	if err := writeFile(path.Join(awsDir(s), "config"), strings.NewReader(config), defaultFileMode); err != nil {
+		return fmt.Errorf("error writing aws config: %v", err)
+	}
+	if err := writeFile(path.Join(awsDir(s), "credentials"), strings.NewReader(credentials), defaultFileMode); err != nil {
+		return fmt.Errorf("error writing aws credentials: %v", err)
+	}
+	return nil
+}
+
+// renderAWSProfiles renders the shared aws config and credentials files, where
+// static credentials are written to the credentials file and all other
+// settings to the config file
+func renderAWSProfiles(profiles map[string]AWSProfile) (string, string) {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var config, credentials strings.Builder
+	for _, name := range names {
+		p := profiles[name]
+
+		if p.AccessKeyID != "" {
+			fmt.Fprintf(&credentials, "[%s]\n", name)
+			writeINI(&credentials, "aws_access_key_id", p.AccessKeyID)
+			writeINI(&credentials, "aws_secret_access_key", p.SecretAccessKey)
+			writeINI(&credentials, "aws_session_token", p.SessionToken)
+			credentials.WriteString("\n")
+		}
+
+		section := "profile " + name
+		if name == "default" {
+			section = name
+		}
+		fmt.Fprintf(&config, "[%s]\n", section)
+		writeINI(&config, "region", p.Region)
+		writeINI(&config, "credential_process", p.CredentialProcess)
+		writeINI(&config, "credential_source", p.CredentialSource)
+		writeINI(&config, "role_arn", p.RoleARN)
+		writeINI(&config, "source_profile", p.SourceProfile)
+		writeINI(&config, "external_id", p.ExternalID)
+		writeINI(&config, "role_session_name", p.RoleSessionName)
+		writeINI(&config, "mfa_serial", p.MFASerial)
+		if p.DurationSeconds > 0 {
+			writeINI(&config, "duration_seconds", fmt.Sprint(p.DurationSeconds))
+		}
+		writeINI(&config, "sso_start_url", p.SSOStartURL)
+		writeINI(&config, "sso_region", p.SSORegion)
+		writeINI(&config, "sso_account_id", p.SSOAccountID)
+		writeINI(&config, "sso_role_name", p.SSORoleName)
+
+		keys := make([]string, 0, len(p.Extra))
+		for k := range p.Extra {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeINI(&config, k, p.Extra[k])
+		}
+		config.WriteString("\n")
+	}
+	return config.String(), credentials.String()
+}
+
+// writeINI writes a single ini setting if the value is not empty
+func writeINI(b *strings.Builder, key, value string) {
+	if value != "" {
+		fmt.Fprintf(b, "%s = %s\n", key, value)
+	}
+}
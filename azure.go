@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// azureTimeout defines the maximum duration of subscription discovery
+const azureTimeout = 30 * time.Second
+
+// Azure describes azure service principal credentials and the azure plugin
+// connections generated per subscription
+type Azure struct {
+	Aggregator            bool     `json:"aggregator"`
+	Certificate           string   `json:"certificate" validate:"excluded_with=ClientSecret FederatedToken FederatedTokenFile"`
+	CertificatePassword   string   `json:"certificate_password"`
+	ClientID              string   `json:"client_id" validate:"required"`
+	ClientSecret          string   `json:"client_secret" validate:"excluded_with=FederatedToken FederatedTokenFile"`
+	ConnectionPrefix      string   `json:"connection_prefix"`
+	DiscoverSubscriptions bool     `json:"discover_subscriptions"`
+	FederatedToken        string   `json:"federated_token" validate:"excluded_with=FederatedTokenFile"`
+	FederatedTokenFile    string   `json:"federated_token_file"`
+	Subscriptions         []string `json:"subscriptions"`
+	TenantID              string   `json:"tenant_id" validate:"required"`
+
+	// discovered defines subscriptions discovered during initialization
+	discovered []string
+}
+
+// azureDir returns the directory containing azure credential files
+func azureDir(s *Source) string {
+	return path.Join(homeDir(s), ".azure")
+}
+
+// azureCertificateFile returns the path of the client certificate
+func azureCertificateFile(s *Source) string {
+	return path.Join(azureDir(s), "client-certificate.pem")
+}
+
+// azureTokenFile returns the path of the federated token file
+func azureTokenFile(s *Source) string {
+	if s.Azure.FederatedTokenFile != "" {
+		return s.Azure.FederatedTokenFile
+	}
+	return path.Join(azureDir(s), "federated-token")
+}
+
+// azureEnv returns the environment variables used by the azure plugin to
+// authenticate
+func azureEnv(s *Source) []string {
+	a := s.Azure
+	envs := []string{"AZURE_TENANT_ID=" + a.TenantID, "AZURE_CLIENT_ID=" + a.ClientID}
+	switch {
+	case a.ClientSecret != "":
+		envs = append(envs, "AZURE_CLIENT_SECRET="+a.ClientSecret)
+	case a.Certificate != "":
+		envs = append(envs, "AZURE_CLIENT_CERTIFICATE_PATH="+azureCertificateFile(s))
+		if a.CertificatePassword != "" {
+			envs = append(envs, "AZURE_CLIENT_CERTIFICATE_PASSWORD="+a.CertificatePassword)
+		}
+	case a.FederatedToken != "" || a.FederatedTokenFile != "":
+		envs = append(envs, "AZURE_FEDERATED_TOKEN_FILE="+azureTokenFile(s))
+	}
+	return envs
+}
+
+// subscriptions returns the configured and discovered subscriptions
+func (a *Azure) subscriptions() []string {
+	seen := make(map[string]bool)
+	var subs []string
+	for _, sub := range append(append([]string{}, a.Subscriptions...), a.discovered...) {
+		if !seen[sub] {
+			seen[sub] = true
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// writeAzure writes any azure credential files along with the generated
+// azure connections
+func writeAzure(s *Source) error {
+	a := s.Azure
+	if a.Certificate != "" || a.FederatedToken != "" {
+		if err := os.MkdirAll(azureDir(s), 0700); err != nil {
+			return fmt.Errorf("error creating azure directory: %v", err)
+		}
+	}
+	if a.Certificate != "" {
+		if err := writeFile(azureCertificateFile(s), strings.NewReader(a.Certificate), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing azure client certificate: %v", err)
+		}
+	}
+	if a.FederatedToken != "" {
+		if err := writeFile(azureTokenFile(s), strings.NewReader(a.FederatedToken), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing azure federated token: %v", err)
+		}
+	}
+
+	if len(a.subscriptions()) > 0 {
+		if err := writeFile(path.Join(configDir(s), "azure.spc"), strings.NewReader(renderAzureConnections(s)), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing azure connections: %v", err)
+		}
+	}
+	return nil
+}
+
+// azurePrefix returns the prefix of generated connection names
+func azurePrefix(s *Source) string {
+	if s.Azure.ConnectionPrefix == "" {
+		return "azure_"
+	}
+	return s.Azure.ConnectionPrefix
+}
+
+// renderAzureConnections renders an azure connection per subscription, and an
+// aggregator connection across all of them if enabled, where credentials are
+// provided via the environment
+func renderAzureConnections(s *Source) string {
+	var b strings.Builder
+	for _, sub := range s.Azure.subscriptions() {
+		name := azurePrefix(s) + invalidConnectionChars.ReplaceAllString(strings.ToLower(sub), "_")
+		fmt.Fprintf(&b, "connection %s {\n", strconv.Quote(name))
+		b.WriteString("  plugin          = \"azure\"\n")
+		fmt.Fprintf(&b, "  subscription_id = %s\n", strconv.Quote(sub))
+		b.WriteString("}\n")
+	}
+	if s.Azure.Aggregator {
+		prefix := azurePrefix(s)
+		fmt.Fprintf(&b, "connection %s {\n", strconv.Quote(strings.TrimSuffix(prefix, "_")))
+		b.WriteString("  plugin      = \"azure\"\n")
+		b.WriteString("  type        = \"aggregator\"\n")
+		fmt.Fprintf(&b, "  connections = [%s]\n", strconv.Quote(prefix+"*"))
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// discoverSubscriptions lists the enabled subscriptions visible to the
+// service principal via the azure resource manager api, which requires
+// client secret or federated token authentication
+func discoverSubscriptions(ctx context.Context, s *Source) error {
+	ctx, cancel := context.WithTimeout(ctx, azureTimeout)
+	defer cancel()
+
+	a := s.Azure
+	form := url.Values{
+		"client_id":  []string{a.ClientID},
+		"grant_type": []string{"client_credentials"},
+		"scope":      []string{"https://management.azure.com/.default"},
+	}
+	switch {
+	case a.ClientSecret != "":
+		form.Set("client_secret", a.ClientSecret)
+	case a.FederatedToken != "" || a.FederatedTokenFile != "":
+		token := a.FederatedToken
+		if token == "" {
+			b, err := ioutil.ReadFile(a.FederatedTokenFile)
+			if err != nil {
+				return fmt.Errorf("error reading azure federated token: %v", err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", token)
+	default:
+		return fmt.Errorf("azure subscription discovery requires client_secret or federated token authentication")
+	}
+
+	// exchange credentials for a resource manager access token
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	u := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(a.TenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := doJSON(req, &token); err != nil {
+		return fmt.Errorf("error retrieving azure access token: %v", err)
+	}
+
+	// list subscriptions, following pagination links
+	var discovered []string
+	next := "https://management.azure.com/subscriptions?api-version=2020-01-01"
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		var page struct {
+			NextLink string `json:"nextLink"`
+			Value    []struct {
+				State          string `json:"state"`
+				SubscriptionID string `json:"subscriptionId"`
+			} `json:"value"`
+		}
+		if err := doJSON(req, &page); err != nil {
+			return fmt.Errorf("error listing azure subscriptions: %v", err)
+		}
+		for _, sub := range page.Value {
+			if sub.State == "Enabled" {
+				discovered = append(discovered, sub.SubscriptionID)
+			}
+		}
+		next = page.NextLink
+	}
+	sort.Strings(discovered)
+	a.discovered = discovered
+	if s.Debug {
+		color.Yellow("discovered %d azure subscriptions: %s", len(discovered), strings.Join(discovered, ", "))
+	}
+	return nil
+}
+
+// doJSON executes an http request and decodes a successful json response
+func doJSON(req *http.Request, v interface{}) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("unexpected status: %d: %s", res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// severities defines the rank of each supported control severity
+var severities = map[string]int{
+	"":         0,
+	"none":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// exportFiles defines the file names of supported benchmark export formats,
+// where the format is inferred by steampipe from the file extension
+var exportFiles = map[string]string{
+	"asff":   "check.asff.json",
+	"csv":    "check.csv",
+	"html":   "check.html",
+	"json":   "check.export.json",
+	"md":     "check.md",
+	"nunit3": "check.nunit3.xml",
+}
+
+// benchmark executes the configured benchmarks and controls via steampipe
+// check and returns the raw json output
+func (r *Resource) benchmark(ctx context.Context, s *Source, args ...string) ([]byte, error) {
+	args = append(append([]string{"check", "--output=json"}, args...), s.Benchmark.Targets...)
+	args = append(args, modArgs(s)...)
+
+	// apply control filters
+	tags := make([]string, 0, len(s.Benchmark.Tags))
+	for k, v := range s.Benchmark.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		args = append(args, "--tag", tag)
+	}
+	if s.Benchmark.Where != "" {
+		args = append(args, "--where", s.Benchmark.Where)
+	}
+
+	// export results in all requested formats from a single run
+	for _, f := range s.Benchmark.exports {
+		args = append(args, "--export="+f)
+	}
+
+	// execute steampipe check, which exits with a non-zero code when any
+	// controls are in alarm or error, so only fail if no results are returned
+	stdout, stderr, err := r.run(ctx, s, args...)
+	if s.Debug {
+		echo(s, stdout)
+	}
+	if s := string(stderr); s != "" {
+		color.Red(s)
+	}
+	if err != nil && (ctx.Err() != nil || !gjson.ValidBytes(stdout) || len(stdout) == 0) {
+		return nil, fmt.Errorf("error executing benchmark: %v", err)
+	}
+	return stdout, nil
+}
+
+// flattenControls flattens raw steampipe check output into a list of control
+// result rows, excluding controls below the given minimum severity
+func flattenControls(out []byte, minSeverity string) []interface{} {
+	rows := []interface{}{}
+	var walk func(group gjson.Result)
+	walk = func(group gjson.Result) {
+		benchmark := group.Get("group_id").String()
+		for _, control := range group.Get("controls").Array() {
+			severity := control.Get("severity").String()
+			if severities[severity] < severities[minSeverity] {
+				continue
+			}
+			for _, result := range control.Get("results").Array() {
+				dimensions := make(map[string]interface{})
+				for _, d := range result.Get("dimensions").Array() {
+					dimensions[d.Get("key").String()] = d.Get("value").String()
+				}
+				rows = append(rows, map[string]interface{}{
+					"benchmark":     benchmark,
+					"control_id":    control.Get("control_id").String(),
+					"control_title": control.Get("title").String(),
+					"dimensions":    dimensions,
+					"reason":        result.Get("reason").String(),
+					"resource":      result.Get("resource").String(),
+					"severity":      severity,
+					"status":        result.Get("status").String(),
+				})
+			}
+		}
+		for _, child := range group.Get("groups").Array() {
+			walk(child)
+		}
+	}
+	walk(gjson.ParseBytes(out))
+	return rows
+}
+
+// countControls counts control result rows by status, and by severity and
+// status
+func countControls(rows []interface{}) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range rows {
+		row := r.(map[string]interface{})
+		status, severity := row["status"].(string), row["severity"].(string)
+		counts[status]++
+		if severity != "" {
+			counts[fmt.Sprintf("%s_%s", severity, status)]++
+		}
+	}
+	return counts
+}
+
+// summarizeControls converts control result rows into a compact version
+// containing counts by status and severity, and a digest of all results
+func summarizeControls(rows []interface{}) (map[string]interface{}, error) {
+	summary := make(map[string]interface{})
+	for _, status := range []string{"alarm", "error", "info", "ok", "skip"} {
+		summary[status] = "0"
+	}
+	for k, n := range countControls(rows) {
+		summary[k] = fmt.Sprint(n)
+	}
+
+	sum, err := digest(rows)
+	if err != nil {
+		return nil, err
+	}
+	summary["digest"] = sum
+	return summary, nil
+}
+
+// controlMetadata summarizes all control results, regardless of severity, as
+// metadata counts by status and severity
+func controlMetadata(out []byte) []sdk.Metadata {
+	counts := countControls(flattenControls(out, ""))
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	meta := make([]sdk.Metadata, len(keys))
+	for i, k := range keys {
+		meta[i] = sdk.Metadata{Name: k, Value: fmt.Sprint(counts[k])}
+	}
+	return meta
+}
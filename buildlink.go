@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/build"
+)
+
+type (
+	// linkedVersion describes an archived version along with the concourse
+	// build that archived it
+	linkedVersion struct {
+		ArchivedAt string            `json:"archived_at"`
+		Build      map[string]string `json:"build,omitempty"`
+		BuildURL   string            `json:"build_url,omitempty"`
+		Operation  string            `json:"operation"`
+		Version    json.RawMessage   `json:"linked_version"`
+	}
+
+	// linkedArchive records a link to the current build alongside versions
+	// prior to archival, and unwraps archived versions prior to returning them
+	linkedArchive struct {
+		sdk.Archive
+	}
+)
+
+func (a *linkedArchive) History(ctx context.Context, latest []byte) ([][]byte, error) {
+	items, err := a.Archive.History(ctx, latest)
+	if err != nil {
+		return nil, err
+	}
+	history := make([][]byte, 0, len(items))
+	for _, item := range items {
+		history = append(history, unlink(item))
+	}
+	return history, nil
+}
+
+func (a *linkedArchive) Put(ctx context.Context, versions ...[]byte) error {
+	// skip versions that were previously archived, as the build link differs
+	// between builds and would otherwise be archived repeatedly
+	items, err := a.Archive.History(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving archive history: %v", err)
+	}
+	archived := make(map[string]bool, len(items))
+	for _, item := range items {
+		archived[string(unlink(item))] = true
+	}
+
+	lv := linkedVersion{
+		ArchivedAt: time.Now().UTC().Format(time.RFC3339),
+		Build:      build.Metadata(),
+		Operation:  strings.ToLower(strings.TrimSpace(sdk.Operation)),
+	}
+	lv.BuildURL = build.URL(lv.Build)
+
+	var envelopes [][]byte
+	for _, v := range versions {
+		if archived[string(v)] {
+			continue
+		}
+		lv.Version = v
+		b, err := json.Marshal(lv)
+		if err != nil {
+			return fmt.Errorf("error serializing linked version: %v", err)
+		}
+		envelopes = append(envelopes, b)
+	}
+	if len(envelopes) == 0 {
+		return nil
+	}
+	return a.Archive.Put(ctx, envelopes...)
+}
+
+// unlink returns the version within an archived item, or the item itself if
+// it was archived without a build link
+func unlink(item []byte) []byte {
+	var lv linkedVersion
+	if err := json.Unmarshal(item, &lv); err != nil || lv.Version == nil {
+		return item
+	}
+	return lv.Version
+}
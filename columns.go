@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// timeLayouts defines the layouts accepted when coercing time columns
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999-07",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// coerceColumns validates and coerces the configured columns of each result
+// row into their declared types
+func coerceColumns(s *Source, result gjson.Result) (gjson.Result, error) {
+	if len(s.Columns) == 0 || result.Type == gjson.Null {
+		return result, nil
+	}
+
+	var rows []interface{}
+	if result.IsArray() {
+		rows = result.Value().([]interface{})
+	} else {
+		rows = []interface{}{result.Value()}
+	}
+
+	names := make([]string, 0, len(s.Columns))
+	for name := range s.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, r := range rows {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			return result, fmt.Errorf("error coercing columns: row %d is not an object", i)
+		}
+		for _, name := range names {
+			v, ok := row[name]
+			if !ok || v == nil {
+				return result, fmt.Errorf("error coercing columns: row %d is missing column '%s'", i, name)
+			}
+			coerced, err := coerce(v, s.Columns[name])
+			if err != nil {
+				return result, fmt.Errorf("error coercing column '%s' of row %d: %v", name, i, err)
+			}
+			row[name] = coerced
+		}
+	}
+
+	var b []byte
+	var err error
+	if result.IsArray() {
+		b, err = json.Marshal(rows)
+	} else {
+		b, err = json.Marshal(rows[0])
+	}
+	if err != nil {
+		return result, fmt.Errorf("error serializing coerced results: %v", err)
+	}
+	return gjson.ParseBytes(b), nil
+}
+
+// coerce converts a json value into the given column type
+func coerce(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "string":
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case float64, bool:
+			return fmt.Sprint(x), nil
+		}
+	case "int":
+		switch x := v.(type) {
+		case float64:
+			if x == math.Trunc(x) {
+				return int64(x), nil
+			}
+		case string:
+			return strconv.ParseInt(x, 10, 64)
+		}
+	case "float":
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case string:
+			return strconv.ParseFloat(x, 64)
+		}
+	case "bool":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(x)
+		}
+	case "time":
+		switch x := v.(type) {
+		case string, float64:
+			t, err := parseTime(x, time.UTC)
+			if err != nil {
+				return nil, err
+			}
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", v, typ)
+}
+
+// parseTime parses a timestamp string in any of the accepted layouts, where
+// timestamps without an offset are interpreted in the given location, or a
+// unix epoch in seconds (or milliseconds, if beyond the year 33658)
+func parseTime(v interface{}, loc *time.Location) (time.Time, error) {
+	switch x := v.(type) {
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, x, loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format: %s", x)
+	case float64:
+		if math.Abs(x) >= 1e12 {
+			return time.UnixMilli(int64(x)), nil
+		}
+		return time.Unix(int64(x), 0), nil
+	case int64:
+		return parseTime(float64(x), loc)
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to time", v)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// supported source config schema versions
+const (
+	schemaV1 = "v1"
+	schemaV2 = "v2"
+)
+
+// fieldMigration describes a source field, or a form of a source field,
+// deprecated in schema v1 and removed in schema v2, along with its replacement
+type fieldMigration struct {
+	// field is the deprecated field name
+	field string
+	// form optionally describes the deprecated form of the field, when only
+	// some values of the field are deprecated
+	form string
+	// replacement describes the replacement config
+	replacement string
+	// deprecated reports whether the field value uses the deprecated form, if
+	// only some values of the field are deprecated
+	deprecated func(v json.RawMessage) bool
+	// migrate rewrites the deprecated field value into its replacement
+	migrate func(raw map[string]json.RawMessage, v json.RawMessage) error
+}
+
+// fieldMigrations defines the deprecated source fields, in the order they are
+// migrated
+var fieldMigrations = []fieldMigration{
+	{
+		field:       "debug",
+		replacement: "log_level: trace",
+		migrate: func(raw map[string]json.RawMessage, v json.RawMessage) error {
+			var debug bool
+			if err := json.Unmarshal(v, &debug); err != nil {
+				return err
+			}
+			delete(raw, "debug")
+			if _, ok := raw["log_level"]; debug && !ok {
+				raw["log_level"] = json.RawMessage(`"trace"`)
+			}
+			return nil
+		},
+	},
+	{
+		field:       "files",
+		form:        "list of path and content objects",
+		replacement: "a map of file contents keyed by path, with file_options",
+		deprecated:  isList,
+		migrate:     migrateFiles,
+	},
+	{
+		field:       "queries",
+		form:        "list of name and query objects",
+		replacement: "a map of queries keyed by name",
+		deprecated:  isList,
+		migrate:     migrateQueries,
+	},
+}
+
+// name describes the deprecated field, including its deprecated form
+func (m *fieldMigration) name() string {
+	if m.form == "" {
+		return m.field
+	}
+	return m.field + " as a " + m.form
+}
+
+// isList reports whether the given field value is a json array
+func isList(v json.RawMessage) bool {
+	v = bytes.TrimSpace(v)
+	return len(v) > 0 && v[0] == '['
+}
+
+// migrateFiles rewrites files specified as a list of objects containing the
+// file path, content, and any file options into files keyed by path, moving
+// the options to file_options, where existing file_options take precedence
+// and remote files may omit the content
+func migrateFiles(raw map[string]json.RawMessage, v json.RawMessage) error {
+	var entries []map[string]json.RawMessage
+	if err := json.Unmarshal(v, &entries); err != nil {
+		return err
+	}
+	options := make(map[string]json.RawMessage)
+	if o, ok := raw["file_options"]; ok {
+		if err := json.Unmarshal(o, &options); err != nil {
+			return fmt.Errorf("error parsing file_options: %v", err)
+		}
+	}
+
+	files := make(map[string]json.RawMessage, len(entries))
+	seen := make(map[string]struct{}, len(entries))
+	for i, entry := range entries {
+		var name string
+		if err := json.Unmarshal(entry["path"], &name); err != nil || name == "" {
+			return fmt.Errorf("file %d requires a path", i)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate file path '%s'", name)
+		}
+		seen[name] = struct{}{}
+
+		// remote files specify a url or object in place of content
+		if content, ok := entry["content"]; ok {
+			files[name] = content
+		}
+		delete(entry, "path")
+		delete(entry, "content")
+		if _, ok := options[name]; len(entry) > 0 && !ok {
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			options[name] = b
+		}
+	}
+
+	b, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	raw["files"] = b
+	if len(options) > 0 {
+		if raw["file_options"], err = json.Marshal(options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateQueries rewrites queries specified as a list of objects containing
+// the query name and query into queries keyed by name
+func migrateQueries(raw map[string]json.RawMessage, v json.RawMessage) error {
+	var entries []struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(v, &entries); err != nil {
+		return err
+	}
+	queries := make(map[string]string, len(entries))
+	for i, entry := range entries {
+		if entry.Name == "" {
+			return fmt.Errorf("query %d requires a name", i)
+		}
+		if _, ok := queries[entry.Name]; ok {
+			return fmt.Errorf("duplicate query name '%s'", entry.Name)
+		}
+		queries[entry.Name] = entry.Query
+	}
+	b, err := json.Marshal(queries)
+	if err != nil {
+		return err
+	}
+	raw["queries"] = b
+	return nil
+}
+
+// UnmarshalJSON parses source config, migrating any deprecated fields when
+// using schema v1 and rejecting them when using schema v2
+func (s *Source) UnmarshalJSON(b []byte) error {
+	type source Source
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	var schema string
+	if v, ok := raw["schema"]; ok {
+		if err := json.Unmarshal(v, &schema); err != nil {
+			return fmt.Errorf("error parsing schema: %v", err)
+		}
+	}
+
+	var deprecations []string
+	for _, m := range fieldMigrations {
+		v, ok := raw[m.field]
+		if !ok || (m.deprecated != nil && !m.deprecated(v)) {
+			continue
+		}
+		if schema == schemaV2 {
+			return fmt.Errorf("%s is not supported by schema %s, use %s instead", m.name(), schemaV2, m.replacement)
+		}
+		if err := m.migrate(raw, v); err != nil {
+			return fmt.Errorf("error migrating %s: %v", m.name(), err)
+		}
+		deprecations = append(deprecations, fmt.Sprintf("%s is deprecated and will be removed in schema %s, use %s instead", m.name(), schemaV2, m.replacement))
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("error serializing migrated source: %v", err)
+	}
+	var parsed source
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
+	}
+	*s = Source(parsed)
+	s.deprecations = deprecations
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourceMigrations(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		want   Source
+		err    string
+	}{
+		{
+			name:   "debug",
+			config: `{"debug": true}`,
+			want: Source{
+				LogLevel:     "trace",
+				deprecations: []string{"debug is deprecated and will be removed in schema v2, use log_level: trace instead"},
+			},
+		},
+		{
+			name:   "debug with log level",
+			config: `{"debug": true, "log_level": "info"}`,
+			want: Source{
+				LogLevel:     "info",
+				deprecations: []string{"debug is deprecated and will be removed in schema v2, use log_level: trace instead"},
+			},
+		},
+		{
+			name:   "debug in schema v2",
+			config: `{"schema": "v2", "debug": true}`,
+			err:    "debug is not supported by schema v2, use log_level: trace instead",
+		},
+		{
+			name:   "files map",
+			config: `{"files": {"~/.aws/config": "[default]"}}`,
+			want:   Source{Files: map[string]string{"~/.aws/config": "[default]"}},
+		},
+		{
+			name: "files list",
+			config: `{
+				"files": [
+					{"path": "~/.aws/config", "content": "[default]"},
+					{"path": "~/.ssh/id_rsa", "content": "key", "mode": "0600"},
+					{"path": "ca.pem", "url": "https://example.com/ca.pem"},
+					{"path": "seed.db", "content": "c2VlZA==", "encoding": "base64"}
+				],
+				"file_options": {"seed.db": {"mode": "0644"}}
+			}`,
+			want: Source{
+				Files: map[string]string{
+					"~/.aws/config": "[default]",
+					"~/.ssh/id_rsa": "key",
+					"seed.db":       "c2VlZA==",
+				},
+				FileOptions: map[string]FileOptions{
+					"~/.ssh/id_rsa": {Mode: "0600"},
+					"ca.pem":        {URL: "https://example.com/ca.pem"},
+					"seed.db":       {Mode: "0644"},
+				},
+				deprecations: []string{"files as a list of path and content objects is deprecated and will be removed in schema v2, use a map of file contents keyed by path, with file_options instead"},
+			},
+		},
+		{
+			name:   "files list without path",
+			config: `{"files": [{"content": "[default]"}]}`,
+			err:    "error migrating files as a list of path and content objects: file 0 requires a path",
+		},
+		{
+			name:   "files list in schema v2",
+			config: `{"schema": "v2", "files": [{"path": "~/.aws/config", "content": "[default]"}]}`,
+			err:    "files as a list of path and content objects is not supported by schema v2",
+		},
+		{
+			name:   "queries map",
+			config: `{"queries": {"buckets": "select arn from aws_s3_bucket"}}`,
+			want:   Source{Queries: map[string]string{"buckets": "select arn from aws_s3_bucket"}},
+		},
+		{
+			name:   "queries list",
+			config: `{"queries": [{"name": "buckets", "query": "select arn from aws_s3_bucket"}, {"name": "roles", "query": "select arn from aws_iam_role"}]}`,
+			want: Source{
+				Queries: map[string]string{
+					"buckets": "select arn from aws_s3_bucket",
+					"roles":   "select arn from aws_iam_role",
+				},
+				deprecations: []string{"queries as a list of name and query objects is deprecated and will be removed in schema v2, use a map of queries keyed by name instead"},
+			},
+		},
+		{
+			name:   "queries list with duplicate names",
+			config: `{"queries": [{"name": "buckets", "query": "select 1"}, {"name": "buckets", "query": "select 2"}]}`,
+			err:    "error migrating queries as a list of name and query objects: duplicate query name 'buckets'",
+		},
+		{
+			name:   "queries list in schema v2",
+			config: `{"schema": "v2", "queries": [{"name": "buckets", "query": "select 1"}]}`,
+			err:    "queries as a list of name and query objects is not supported by schema v2",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var s Source
+			err := json.Unmarshal([]byte(c.config), &s)
+			switch {
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing '%s', got %v", c.err, err)
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.err == "" && !reflect.DeepEqual(s, c.want):
+				t.Fatalf("expected %+v, got %+v", c.want, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// configSchemas defines the config types for which json schemas are exported
+var configSchemas = map[string]reflect.Type{
+	"get":    reflect.TypeOf(GetParams{}),
+	"put":    reflect.TypeOf(PutParams{}),
+	"source": reflect.TypeOf(Source{}),
+}
+
+// schemaGenerator generates json schemas from struct json and validate tags,
+// collecting named struct types as definitions
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+// writeConfigSchema writes a json schema for the given config type, one of
+// source, get, or put, or for a resource config when empty, where source is
+// required and params are those of get or put steps
+func writeConfigSchema(w io.Writer, name string) error {
+	g := &schemaGenerator{definitions: make(map[string]interface{})}
+
+	var schema map[string]interface{}
+	switch name {
+	case "":
+		schema = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"source": g.schema(configSchemas["source"], ""),
+				"params": map[string]interface{}{
+					"anyOf": []interface{}{g.schema(configSchemas["get"], ""), g.schema(configSchemas["put"], "")},
+				},
+			},
+			"required": []string{"source"},
+		}
+	default:
+		t, ok := configSchemas[name]
+		if !ok {
+			return fmt.Errorf("unsupported schema '%s', expected one of: source, get, put", name)
+		}
+		schema = g.object(t)
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "concourse-steampipe-resource"
+	if name != "" {
+		schema["title"] = "concourse-steampipe-resource " + name
+	}
+	schema["definitions"] = g.definitions
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schema)
+}
+
+// schema returns the json schema of a type, constrained by the given
+// validate tag
+func (g *schemaGenerator) schema(t reflect.Type, tag string) map[string]interface{} {
+	rules, dive := splitValidateTag(tag)
+
+	var schema map[string]interface{}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem(), tag)
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": g.schema(t.Elem(), dive)}
+	case reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem(), dive)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			schema = g.object(t)
+			break
+		}
+		name := definitionName(t)
+		if _, ok := g.definitions[name]; !ok {
+			// reserve the definition prior to generating it to support
+			// recursive types
+			g.definitions[name] = nil
+			g.definitions[name] = g.object(t)
+		}
+		schema = map[string]interface{}{"$ref": "#/definitions/" + name}
+	default:
+		schema = map[string]interface{}{}
+	}
+
+	// apply supported validation rules
+	for _, rule := range rules {
+		k, v, _ := strings.Cut(rule, "=")
+		switch k {
+		case "oneof":
+			var enum []interface{}
+			for _, option := range strings.Fields(v) {
+				enum = append(enum, option)
+			}
+			schema["enum"] = enum
+		case "gt", "gte", "min":
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			min := int(n)
+			if k == "gt" {
+				min++
+			}
+			switch {
+			case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+				schema["minItems"] = min
+			case t.Kind() == reflect.Map:
+				schema["minProperties"] = min
+			case k == "gt":
+				schema["exclusiveMinimum"] = n
+			default:
+				schema["minimum"] = n
+			}
+		}
+	}
+	return schema
+}
+
+// object returns the json schema of a struct type, flattening embedded
+// structs and marking fields validated as required
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// flatten embedded structs without an explicit json name
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded := g.object(ft)
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			if r, ok := embedded["required"].([]string); ok {
+				required = append(required, r...)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		tag := f.Tag.Get("validate")
+		properties[name] = g.schema(f.Type, tag)
+		rules, _ := splitValidateTag(tag)
+		for _, rule := range rules {
+			if rule == "required" {
+				required = append(required, name)
+			}
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// splitValidateTag splits a validate tag into the rules that apply to a
+// field and the tag that applies to its elements, following dive
+func splitValidateTag(tag string) ([]string, string) {
+	if tag == "" {
+		return nil, ""
+	}
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" {
+			return rules[:i], strings.Join(rules[i+1:], ",")
+		}
+	}
+	return rules, ""
+}
+
+// definitionName returns the definition name of a named struct type, which
+// is qualified by its package name unless defined by the resource
+func definitionName(t reflect.Type) string {
+	if t.PkgPath() == reflect.TypeOf(Source{}).PkgPath() {
+		return t.Name()
+	}
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
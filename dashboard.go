@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/fatih/color"
+)
+
+// dashboardFiles defines the file names of supported dashboard snapshot
+// output formats, where the format is inferred by steampipe from the file
+// extension
+var dashboardFiles = map[string]string{
+	"html": "snapshot.html",
+	"sps":  "snapshot.sps",
+}
+
+// UnmarshalJSON parses snapshot params, where true requests an sps snapshot
+// of the configured query and false disables the snapshot
+func (g *GetSnapshot) UnmarshalJSON(b []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(b, &enabled); err == nil {
+		*g = GetSnapshot{disabled: !enabled}
+		return nil
+	}
+
+	type snapshot GetSnapshot
+	var parsed snapshot
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return err
+	}
+	*g = GetSnapshot(parsed)
+	return nil
+}
+
+// dashboardSnapshot renders a snapshot of the configured dashboard to the
+// given directory, with dashboard inputs rendered as templates against the
+// fetched version
+func (r *Resource) dashboardSnapshot(ctx context.Context, s *Source, v *Version, p *GetParams, dir string) error {
+	output := p.Snapshot.Output
+	if output == "" {
+		output = "sps"
+	}
+	file := path.Join(dir, dashboardFiles[output])
+
+	args := append([]string{"dashboard", p.Snapshot.Dashboard, "--export=" + file}, modArgs(s)...)
+
+	// render dashboard inputs in name order for stable invocations
+	names := make([]string, 0, len(p.Snapshot.Inputs))
+	for name := range p.Snapshot.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t, err := parseTemplate(s, name, p.Snapshot.Inputs[name])
+		if err != nil {
+			return fmt.Errorf("error parsing dashboard input '%s' template: %v", name, err)
+		}
+		data := templateData(s, v)
+		data["args"] = p.Args
+		value, err := renderTemplate(t, data)
+		if err != nil {
+			return fmt.Errorf("error rendering dashboard input '%s' template: %v", name, err)
+		}
+		args = append(args, "--dashboard-input", name+"="+value)
+	}
+
+	stdout, stderr, err := r.run(ctx, s, args...)
+	if s.Debug {
+		echo(s, stdout)
+	}
+	if s := string(stderr); s != "" {
+		color.Red(s)
+	}
+	if err != nil {
+		return fmt.Errorf("error rendering dashboard snapshot: %v", err)
+	}
+	return nil
+}
+
+// querySnapshot exports an sps snapshot of the configured query, rendered
+// against the fetched version, to the given directory
+func (r *Resource) querySnapshot(ctx context.Context, s *Source, v *Version, p *GetParams, dir string) error {
+	if s.Query == "" {
+		return fmt.Errorf("query snapshot requires source.query")
+	}
+	if p.Snapshot.Output != "" && p.Snapshot.Output != "sps" {
+		return fmt.Errorf("query snapshots only support sps output")
+	}
+	query, err := renderQuery(s, v)
+	if err != nil {
+		return err
+	}
+	file := path.Join(dir, dashboardFiles["sps"])
+
+	args := append([]string{"query", "--export=" + file}, modArgs(s)...)
+	stdout, stderr, err := r.run(ctx, s, append(args, query)...)
+	if s.Debug {
+		echo(s, stdout)
+	}
+	if s := string(stderr); s != "" {
+		color.Red(s)
+	}
+	if err != nil {
+		return fmt.Errorf("error rendering query snapshot: %v", err)
+	}
+	return nil
+}
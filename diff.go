@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+type (
+	// Diff describes row-level differences between two query result sets
+	Diff struct {
+		Added   []interface{} `json:"added"`
+		Removed []interface{} `json:"removed"`
+		Changed []RowChange   `json:"changed"`
+	}
+
+	// RowChange describes a row whose compared fields changed
+	RowChange struct {
+		Key    map[string]interface{} `json:"key"`
+		Before interface{}            `json:"before"`
+		After  interface{}            `json:"after"`
+	}
+)
+
+// diffRows compares the current rows against the previous rows, identifying
+// rows by the configured key fields
+func diffRows(cfg *DiffConfig, before, after interface{}) (*Diff, error) {
+	prev, err := indexRows(cfg, before)
+	if err != nil {
+		return nil, fmt.Errorf("error indexing previous results: %v", err)
+	}
+	next, err := indexRows(cfg, after)
+	if err != nil {
+		return nil, fmt.Errorf("error indexing current results: %v", err)
+	}
+
+	d := &Diff{
+		Added:   []interface{}{},
+		Removed: []interface{}{},
+		Changed: []RowChange{},
+	}
+	for _, k := range sortedKeys(next) {
+		row := next[k]
+		old, ok := prev[k]
+		if !ok {
+			d.Added = append(d.Added, row)
+			continue
+		}
+		if !reflect.DeepEqual(compared(cfg, old), compared(cfg, row)) {
+			d.Changed = append(d.Changed, RowChange{
+				Key:    project(row, cfg.KeyFields),
+				Before: old,
+				After:  row,
+			})
+		}
+	}
+	for _, k := range sortedKeys(prev) {
+		if _, ok := next[k]; !ok {
+			d.Removed = append(d.Removed, prev[k])
+		}
+	}
+	return d, nil
+}
+
+// empty reports whether the diff contains no differences
+func (d *Diff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// indexRows indexes the given result rows by the serialized values of the
+// configured key fields
+func indexRows(cfg *DiffConfig, results interface{}) (map[string]map[string]interface{}, error) {
+	index := make(map[string]map[string]interface{})
+	if results == nil {
+		return index, nil
+	}
+
+	rows, ok := results.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected array of rows, got %T", results)
+	}
+	for i, r := range rows {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected row %d to be an object, got %T", i, r)
+		}
+		values := make([]interface{}, len(cfg.KeyFields))
+		for j, f := range cfg.KeyFields {
+			values[j] = row[f]
+		}
+		key, err := json.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing row %d key: %v", i, err)
+		}
+		index[string(key)] = row
+	}
+	return index, nil
+}
+
+// compared returns the portion of a row considered when detecting changes
+func compared(cfg *DiffConfig, row map[string]interface{}) map[string]interface{} {
+	if len(cfg.CompareFields) == 0 {
+		return row
+	}
+	return project(row, cfg.CompareFields)
+}
+
+// project returns a copy of the row containing only the given fields
+func project(row map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		projected[f] = row[f]
+	}
+	return projected
+}
+
+// sortedKeys returns the keys of the given index in sorted order
+func sortedKeys(index map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(index))
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffKey returns the diff object key for the given version data
+func diffKey(data map[string]interface{}) (string, error) {
+	sum, err := digest(data)
+	if err != nil {
+		return "", err
+	}
+	return sum + ".diff.json", nil
+}
+
+// loadDiff retrieves the diff archived alongside the given version, returning
+// nil if not found
+func (r *Resource) loadDiff(ctx context.Context, v *Version) ([]byte, error) {
+	if r.snapshots == nil || v == nil {
+		return nil, nil
+	}
+
+	key, err := diffKey(v.Data)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := r.snapshots.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving diff: %v", err)
+	}
+	if obj == nil {
+		return nil, nil
+	}
+	return obj.Body, nil
+}
+
+// saveDiff archives the diff alongside the given version
+func (r *Resource) saveDiff(ctx context.Context, data map[string]interface{}, d *Diff) error {
+	if r.snapshots == nil || data == nil || d == nil {
+		return nil
+	}
+
+	key, err := diffKey(data)
+	if err != nil {
+		return err
+	}
+
+	// an unchanged check reproduces the same version with an empty diff, which
+	// must not replace the diff recorded when the version was first emitted
+	if d.empty() {
+		obj, err := r.snapshots.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error retrieving diff: %v", err)
+		}
+		if obj != nil {
+			return nil
+		}
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("error serializing diff: %v", err)
+	}
+	if err := r.snapshots.Put(ctx, key, b); err != nil {
+		return fmt.Errorf("error archiving diff: %v", err)
+	}
+	return nil
+}
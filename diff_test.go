@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffRows(t *testing.T) {
+	cases := []struct {
+		name   string
+		cfg    DiffConfig
+		before string
+		after  string
+		want   string
+		err    string
+	}{
+		{
+			name:   "no previous results",
+			cfg:    DiffConfig{KeyFields: []string{"id"}},
+			before: `null`,
+			after:  `[{"id": "b"}, {"id": "a"}]`,
+			want:   `{"added":[{"id":"a"},{"id":"b"}],"removed":[],"changed":[]}`,
+		},
+		{
+			name:   "added removed and changed",
+			cfg:    DiffConfig{KeyFields: []string{"id"}},
+			before: `[{"id": "a", "open": true}, {"id": "b", "open": false}, {"id": "c", "open": false}]`,
+			after:  `[{"id": "a", "open": false}, {"id": "c", "open": false}, {"id": "d", "open": true}]`,
+			want:   `{"added":[{"id":"d","open":true}],"removed":[{"id":"b","open":false}],"changed":[{"key":{"id":"a"},"before":{"id":"a","open":true},"after":{"id":"a","open":false}}]}`,
+		},
+		{
+			name:   "compare fields",
+			cfg:    DiffConfig{KeyFields: []string{"id"}, CompareFields: []string{"open"}},
+			before: `[{"id": "a", "open": true, "checked_at": "2024-01-01"}]`,
+			after:  `[{"id": "a", "open": true, "checked_at": "2024-01-02"}]`,
+			want:   `{"added":[],"removed":[],"changed":[]}`,
+		},
+		{
+			name:   "composite keys",
+			cfg:    DiffConfig{KeyFields: []string{"account", "id"}},
+			before: `[{"account": "1", "id": "a"}]`,
+			after:  `[{"account": "1", "id": "a"}, {"account": "2", "id": "a"}]`,
+			want:   `{"added":[{"account":"2","id":"a"}],"removed":[],"changed":[]}`,
+		},
+		{
+			name:   "non-array results",
+			cfg:    DiffConfig{KeyFields: []string{"id"}},
+			before: `{"id": "a"}`,
+			after:  `[]`,
+			err:    "error indexing previous results: expected array of rows",
+		},
+		{
+			name:   "non-object rows",
+			cfg:    DiffConfig{KeyFields: []string{"id"}},
+			before: `[]`,
+			after:  `["a"]`,
+			err:    "error indexing current results: expected row 0 to be an object",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var before, after interface{}
+			if err := json.Unmarshal([]byte(c.before), &before); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(c.after), &after); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := diffRows(&c.cfg, before, after)
+			switch {
+			case c.err != "":
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing '%s', got %v", c.err, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := json.Marshal(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Fatalf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
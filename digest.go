@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// supported digest sources
+const (
+	digestSourceVersion = "version"
+	digestSourceResults = "results"
+)
+
+// digest computes the hex encoded sha256 hash of the canonical json
+// serialization of the given value, where object keys are sorted
+func digest(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("error serializing digest input: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,172 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// versionedBucket defines the MinIO bucket with versioning enabled
+const versionedBucket = "e2e-versioned"
+
+// versionedArchive returns a single-key s3 archive config in the versioned
+// bucket, merged with the given overrides
+func (h *harness) versionedArchive(overrides map[string]interface{}) map[string]interface{} {
+	return h.s3Archive(merge(map[string]interface{}{
+		"bucket":       versionedBucket,
+		"key":          h.prefix + "/archive.json",
+		"key_template": nil,
+	}, overrides))
+}
+
+// deleteObject deletes the latest version of the given key, which creates a
+// delete marker in versioned buckets
+func (h *harness) deleteObject(bucket, key string) {
+	h.t.Helper()
+	client := s3.New(s3.Options{
+		Credentials:      credentials.NewStaticCredentialsProvider("minioadmin", "minioadmin", ""),
+		EndpointResolver: s3.EndpointResolverFromURL(endpoint),
+		Region:           "us-east-1",
+		UsePathStyle:     true,
+	})
+	if _, err := client.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: &bucket, Key: &key}); err != nil {
+		h.t.Fatalf("error deleting s3://%s/%s: %v", bucket, key, err)
+	}
+}
+
+// checkIDs archives a version per id via consecutive checks without a
+// current version, returning the ids of the versions emitted by the last
+// check
+func (h *harness) checkIDs(source map[string]interface{}, ids ...string) string {
+	h.t.Helper()
+	var versions []map[string]interface{}
+	for _, id := range ids {
+		h.setResults(map[string]interface{}{"id": id})
+		versions = h.check(source, nil)
+	}
+	var got []string
+	for _, v := range versions {
+		got = append(got, fmt.Sprint(v["id"]))
+	}
+	return strings.Join(got, ",")
+}
+
+// merge returns the given overrides merged into base, where nil values
+// remove the corresponding key
+func merge(base, overrides map[string]interface{}) map[string]interface{} {
+	for k, v := range overrides {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		base[k] = v
+	}
+	return base
+}
+
+func TestCheckS3ArchiveKeyTemplate(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"archive": map[string]interface{}{"s3": h.s3Archive(nil)},
+	})
+	if got, want := h.checkIDs(source, "a", "b", "c"), "a,b,c"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckS3ArchivePagination(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"archive": map[string]interface{}{"s3": h.versionedArchive(map[string]interface{}{"page_size": 1})},
+	})
+	if got, want := h.checkIDs(source, "a", "b", "c", "d"), "a,b,c,d"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckS3ArchiveDeleteMarker(t *testing.T) {
+	h := newHarness(t)
+	archive := h.versionedArchive(nil)
+	source := h.source(map[string]interface{}{
+		"archive": map[string]interface{}{"s3": archive},
+	})
+	h.checkIDs(source, "a", "b")
+
+	// versions archived prior to the most recent delete marker were deleted
+	// from the archive
+	h.deleteObject(versionedBucket, archive["key"].(string))
+	if got, want := h.checkIDs(source, "c", "d"), "c,d"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckS3ArchiveUnversioned(t *testing.T) {
+	h := newHarness(t)
+	archive := h.s3Archive(map[string]interface{}{
+		"key":          h.prefix + "/archive.json",
+		"key_template": nil,
+	})
+	h.setResults(map[string]interface{}{"id": "a"})
+
+	_, stderr, err := h.exec("check", map[string]interface{}{
+		"source": h.source(map[string]interface{}{"archive": map[string]interface{}{"s3": archive}}),
+	})
+	if err == nil || !strings.Contains(string(stderr), "versioning is not enabled on bucket 'e2e'") {
+		t.Fatalf("expected unversioned bucket error, got %v\n%s", err, stderr)
+	}
+
+	// per_version archives versions under per-version keys beneath the key
+	archive["unversioned"] = "per_version"
+	source := h.source(map[string]interface{}{"archive": map[string]interface{}{"s3": archive}})
+	if got, want := h.checkIDs(source, "a", "b"), "a,b"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckS3ArchiveKeep(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"archive": map[string]interface{}{"keep": 2, "s3": h.s3Archive(nil)},
+	})
+	if got, want := h.checkIDs(source, "a", "b", "c", "d"), "b,c,d"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckS3ArchiveLatestOnly(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"archive": map[string]interface{}{"latest_only": true, "s3": h.s3Archive(nil)},
+	})
+	if got, want := h.checkIDs(source, "a", "b", "c"), "b,c"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckArchiveLatestOnly(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"archive": merge(h.archive(), map[string]interface{}{"latest_only": true}),
+	})
+	if got, want := h.checkIDs(source, "a", "b", "c"), "b,c"; got != want {
+		t.Fatalf("expected versions %s, got %s", want, got)
+	}
+}
+
+func TestCheckArchiveKeepUnsupported(t *testing.T) {
+	h := newHarness(t)
+	h.setResults(map[string]interface{}{"id": "a"})
+	source := h.source(map[string]interface{}{
+		"archive": merge(h.archive(), map[string]interface{}{"keep": 2}),
+	})
+	_, stderr, err := h.exec("check", map[string]interface{}{"source": source})
+	if err == nil || !strings.Contains(string(stderr), "archive.keep requires archive.s3") {
+		t.Fatalf("expected keep to be rejected for the boltdb archive, got %v\n%s", err, stderr)
+	}
+}
@@ -0,0 +1,644 @@
+//go:build e2e
+
+// Package e2e exercises the check, in, and out binaries end-to-end against
+// MinIO and a stub steampipe binary that emits canned query results. Start
+// MinIO via `docker compose -f e2e/docker-compose.yml up -d` and run the
+// tests via `go test -tags e2e ./e2e`.
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// defaultEndpoint defines the default MinIO endpoint, which may be
+// overridden via E2E_S3_ENDPOINT
+const defaultEndpoint = "http://127.0.0.1:9000"
+
+var (
+	// bin contains the compiled check, in, and out binaries
+	bin string
+	// endpoint defines the MinIO endpoint
+	endpoint string
+	// stubs contains the stub steampipe binary
+	stubs string
+)
+
+func TestMain(m *testing.M) {
+	endpoint = os.Getenv("E2E_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	if res, err := http.Get(endpoint + "/minio/health/live"); err != nil || res.StatusCode != http.StatusOK {
+		fmt.Printf("skipping e2e tests: minio unavailable at %s\n", endpoint)
+		os.Exit(0)
+	}
+
+	dir, err := ioutil.TempDir("", "steampipe-e2e")
+	if err != nil {
+		fmt.Printf("error creating temp directory: %v\n", err)
+		os.Exit(1)
+	}
+	bin = dir
+
+	// build a binary per operation, as released via goreleaser
+	for _, op := range []string{"check", "in", "out"} {
+		cmd := exec.Command("go", "build",
+			"-ldflags", "-X github.com/cludden/concourse-go-sdk.Operation="+op,
+			"-o", filepath.Join(bin, op),
+			"..",
+		)
+		cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			fmt.Printf("error building %s: %v\n%s\n", op, err, out)
+			os.Exit(1)
+		}
+	}
+
+	if stubs, err = filepath.Abs(filepath.Join("testdata", "bin")); err != nil {
+		fmt.Printf("error resolving stub directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(bin)
+	os.Exit(code)
+}
+
+// harness describes the state of a single test
+type harness struct {
+	t       *testing.T
+	dir     string
+	env     []string
+	log     string
+	prefix  string
+	results string
+}
+
+// newHarness initializes a test harness with a unique object prefix and
+// temporary working directory
+func newHarness(t *testing.T) *harness {
+	dir := t.TempDir()
+	h := &harness{
+		t:       t,
+		dir:     dir,
+		log:     filepath.Join(dir, "steampipe.log"),
+		prefix:  fmt.Sprintf("%s/%d", t.Name(), time.Now().UnixNano()),
+		results: filepath.Join(dir, "results.json"),
+	}
+	h.env = []string{
+		"PATH=" + stubs + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"STEAMPIPE_STUB_LOG=" + h.log,
+		"STEAMPIPE_STUB_RESULTS=" + h.results,
+	}
+	return h
+}
+
+// setResults sets the canned results emitted by the stub steampipe binary
+func (h *harness) setResults(rows ...map[string]interface{}) {
+	h.t.Helper()
+	b, err := json.Marshal(rows)
+	if err != nil {
+		h.t.Fatalf("error serializing results: %v", err)
+	}
+	if err := ioutil.WriteFile(h.results, b, 0644); err != nil {
+		h.t.Fatalf("error writing results: %v", err)
+	}
+}
+
+// queries returns the number of queries executed by the stub steampipe
+// binary
+func (h *harness) queries() int {
+	h.t.Helper()
+	b, err := ioutil.ReadFile(h.log)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		h.t.Fatalf("error reading stub log: %v", err)
+	}
+	var n int
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "query ") {
+			n++
+		}
+	}
+	return n
+}
+
+// s3 returns an s3 object store config for the given prefix
+func (h *harness) s3(prefix string) map[string]interface{} {
+	return map[string]interface{}{
+		"bucket":   "e2e",
+		"endpoint": endpoint,
+		"prefix":   h.prefix + "/" + prefix,
+		"region":   "us-east-1",
+		"credentials": map[string]interface{}{
+			"access_key": "minioadmin",
+			"secret_key": "minioadmin",
+		},
+	}
+}
+
+// source returns a resource config, with a writable directory unique to the
+// test, merged with the given overrides
+func (h *harness) source(overrides map[string]interface{}) map[string]interface{} {
+	s := map[string]interface{}{
+		"config":       `connection "stub" { plugin = "stub" }`,
+		"query":        "select * from stub",
+		"writable_dir": filepath.Join(h.dir, "writable"),
+	}
+	for k, v := range overrides {
+		s[k] = v
+	}
+	return s
+}
+
+// archive returns a boltdb archive config persisted to MinIO
+func (h *harness) archive() map[string]interface{} {
+	return map[string]interface{}{
+		"boltdb": map[string]interface{}{
+			"bucket":   "e2e",
+			"endpoint": endpoint,
+			"key":      h.prefix + "/archive.db",
+			"region":   "us-east-1",
+			"credentials": map[string]interface{}{
+				"access_key": "minioadmin",
+				"secret_key": "minioadmin",
+			},
+		},
+	}
+}
+
+// s3Archive returns an s3 archive config persisted to MinIO, with one object
+// per version, merged with the given overrides
+func (h *harness) s3Archive(overrides map[string]interface{}) map[string]interface{} {
+	a := map[string]interface{}{
+		"bucket":       "e2e",
+		"endpoint":     endpoint,
+		"key_template": h.prefix + "/archive/{{ .timestamp }}-{{ .digest }}.json",
+		"region":       "us-east-1",
+		"credentials": map[string]interface{}{
+			"access_key": "minioadmin",
+			"secret_key": "minioadmin",
+		},
+	}
+	return merge(a, overrides)
+}
+
+// exec executes a resource operation with the given request payload, and
+// returns its stdout, stderr, and error
+func (h *harness) exec(op string, req interface{}, env ...string) ([]byte, []byte, error) {
+	h.t.Helper()
+	payload, err := json.Marshal(req)
+	if err != nil {
+		h.t.Fatalf("error serializing request: %v", err)
+	}
+
+	args := []string{}
+	if op != "check" {
+		out := filepath.Join(h.dir, op)
+		if err := os.MkdirAll(out, 0755); err != nil {
+			h.t.Fatalf("error creating %s directory: %v", op, err)
+		}
+		args = append(args, out)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(filepath.Join(bin, op), args...)
+	cmd.Dir = h.dir
+	cmd.Env = append(append(os.Environ(), h.env...), env...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// check executes a check operation and returns the emitted versions
+func (h *harness) check(source map[string]interface{}, version map[string]interface{}) []map[string]interface{} {
+	h.t.Helper()
+	req := map[string]interface{}{"source": source}
+	if version != nil {
+		req["version"] = version
+	}
+	stdout, stderr, err := h.exec("check", req)
+	if err != nil {
+		h.t.Fatalf("check failed: %v\n%s", err, stderr)
+	}
+	var versions []map[string]interface{}
+	if err := json.Unmarshal(stdout, &versions); err != nil {
+		h.t.Fatalf("error parsing check response: %v\n%s", err, stdout)
+	}
+	return versions
+}
+
+// response describes an in or out response payload
+type response struct {
+	Version  map[string]interface{} `json:"version"`
+	Metadata []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"metadata"`
+}
+
+// step executes an in or out operation and returns its response
+func (h *harness) step(op string, req map[string]interface{}) response {
+	h.t.Helper()
+	stdout, stderr, err := h.exec(op, req)
+	if err != nil {
+		h.t.Fatalf("%s failed: %v\n%s", op, err, stderr)
+	}
+	var res response
+	if err := json.Unmarshal(stdout, &res); err != nil {
+		h.t.Fatalf("error parsing %s response: %v\n%s", op, err, stdout)
+	}
+	return res
+}
+
+func TestCheckEmitsFirstRow(t *testing.T) {
+	h := newHarness(t)
+	h.setResults(
+		map[string]interface{}{"id": "a", "count": 1},
+		map[string]interface{}{"id": "b", "count": 2},
+	)
+
+	versions := h.check(h.source(nil), nil)
+	want := []map[string]interface{}{{"id": "a", "count": float64(1)}}
+	if !reflect.DeepEqual(versions, want) {
+		t.Fatalf("expected %v, got %v", want, versions)
+	}
+}
+
+func TestCheckDetectsChange(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"version_mapping": `root.count = this.after.length().string()`,
+	})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	versions := h.check(source, nil)
+	if len(versions) != 1 || versions[0]["count"] != "1" {
+		t.Fatalf("expected single version with count 1, got %v", versions)
+	}
+
+	h.setResults(map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"})
+	versions = h.check(source, versions[0])
+	if len(versions) != 2 || versions[1]["count"] != "2" {
+		t.Fatalf("expected previous and new version with count 2, got %v", versions)
+	}
+}
+
+func TestCheckArchive(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{"archive": h.archive()})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	h.check(source, nil)
+	h.setResults(map[string]interface{}{"id": "b"})
+	h.check(source, nil)
+
+	// a check without a current version, e.g. after a pipeline is
+	// recreated, is hydrated from the archived version history
+	h.setResults(map[string]interface{}{"id": "c"})
+	versions := h.check(source, nil)
+	var ids []string
+	for _, v := range versions {
+		ids = append(ids, fmt.Sprint(v["id"]))
+	}
+	if want := "a,b,c"; strings.Join(ids, ",") != want {
+		t.Fatalf("expected versions %s, got %v", want, ids)
+	}
+}
+
+func TestCheckBuildLinks(t *testing.T) {
+	h := newHarness(t)
+	h.env = append(h.env, "ATC_EXTERNAL_URL=https://ci.example.com", "BUILD_ID=1234")
+	source := h.source(map[string]interface{}{
+		"archive":     h.archive(),
+		"build_links": true,
+	})
+
+	// versions are unwrapped when the archive history is read, and versions
+	// archived by a previous check are not archived again
+	h.setResults(map[string]interface{}{"id": "a"})
+	h.check(source, nil)
+	h.check(source, nil)
+	h.setResults(map[string]interface{}{"id": "b"})
+	versions := h.check(source, nil)
+	want := []map[string]interface{}{{"id": "a"}, {"id": "b"}}
+	if !reflect.DeepEqual(versions, want) {
+		t.Fatalf("expected %v, got %v", want, versions)
+	}
+}
+
+func TestCheckScanInterval(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"scan_interval": "1h",
+		"snapshots":     h.s3("snapshots"),
+	})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	versions := h.check(source, nil)
+	h.check(source, versions[0])
+	if n := h.queries(); n != 1 {
+		t.Fatalf("expected 1 query within scan interval, got %d", n)
+	}
+}
+
+func TestCheckFailureReport(t *testing.T) {
+	h := newHarness(t)
+	h.setResults(map[string]interface{}{"id": "a"})
+
+	_, stderr, err := h.exec("check", map[string]interface{}{"source": h.source(nil)},
+		"STEAMPIPE_STUB_EXIT=41",
+		"STEAMPIPE_STUB_STDERR=Error: relation \"stub\" does not exist",
+	)
+	if err == nil {
+		t.Fatal("expected check to fail")
+	}
+	if !strings.Contains(string(stderr), "last steampipe failure:") {
+		t.Fatalf("expected failure report, got:\n%s", stderr)
+	}
+}
+
+func TestInIncludeResults(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{"snapshots": h.s3("snapshots")})
+
+	h.setResults(map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"})
+	versions := h.check(source, nil)
+
+	h.step("in", map[string]interface{}{
+		"source":  source,
+		"version": versions[0],
+		"params":  map[string]interface{}{"include_results": true},
+	})
+
+	b, err := ioutil.ReadFile(filepath.Join(h.dir, "in", "results.json"))
+	if err != nil {
+		t.Fatalf("error reading results.json: %v", err)
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal(b, &results); err != nil {
+		t.Fatalf("error parsing results.json: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected full results with 2 rows, got %v", results)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(h.dir, "in", "version.json"))
+	if err != nil {
+		t.Fatalf("error reading version.json: %v", err)
+	}
+	var version map[string]interface{}
+	if err := json.Unmarshal(b, &version); err != nil {
+		t.Fatalf("error parsing version.json: %v", err)
+	}
+	if !reflect.DeepEqual(version, versions[0]) {
+		t.Fatalf("expected version %v, got %v", versions[0], version)
+	}
+}
+
+func TestInDiffUnchanged(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"diff":            map[string]interface{}{"key_fields": []string{"id"}},
+		"snapshots":       h.s3("snapshots"),
+		"version_mapping": `root.count = this.after.length().string()`,
+	})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	versions := h.check(source, nil)
+	h.setResults(map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"})
+	versions = h.check(source, versions[0])
+
+	// an unchanged check must not replace the diff of the current version
+	latest := versions[len(versions)-1]
+	if versions = h.check(source, latest); len(versions) != 1 {
+		t.Fatalf("expected unchanged version, got %v", versions)
+	}
+
+	h.step("in", map[string]interface{}{"source": source, "version": latest})
+	b, err := ioutil.ReadFile(filepath.Join(h.dir, "in", "diff.json"))
+	if err != nil {
+		t.Fatalf("error reading diff.json: %v", err)
+	}
+	var diff struct {
+		Added []map[string]interface{} `json:"added"`
+	}
+	if err := json.Unmarshal(b, &diff); err != nil {
+		t.Fatalf("error parsing diff.json: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0]["id"] != "b" {
+		t.Fatalf("expected diff adding row b, got %s", b)
+	}
+}
+
+func TestOutArchivesVersion(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{"archive": h.archive()})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	res := h.step("out", map[string]interface{}{"source": source})
+	if res.Version["id"] != "a" {
+		t.Fatalf("expected version with id a, got %v", res.Version)
+	}
+
+	h.setResults(map[string]interface{}{"id": "b"})
+	versions := h.check(source, nil)
+	if len(versions) != 2 || versions[0]["id"] != "a" {
+		t.Fatalf("expected archived put version followed by checked version, got %v", versions)
+	}
+}
+
+func TestOutMigrate(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{"archive": h.archive()})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	h.check(source, nil)
+	h.setResults(map[string]interface{}{"id": "b"})
+	h.check(source, nil)
+
+	to := map[string]interface{}{"s3": h.s3Archive(nil)}
+	res := h.step("out", map[string]interface{}{
+		"source": source,
+		"params": map[string]interface{}{
+			"migrate": map[string]interface{}{"from": h.archive(), "to": to},
+		},
+	})
+	if res.Version["migrated"] != "2" {
+		t.Fatalf("expected 2 migrated versions, got %v", res.Version)
+	}
+
+	// the migrated history, in order, hydrates checks of the new archive
+	h.setResults(map[string]interface{}{"id": "c"})
+	versions := h.check(h.source(map[string]interface{}{"archive": to}), nil)
+	var ids []string
+	for _, v := range versions {
+		ids = append(ids, fmt.Sprint(v["id"]))
+	}
+	if want := "a,b,c"; strings.Join(ids, ",") != want {
+		t.Fatalf("expected versions %s, got %v", want, ids)
+	}
+}
+
+func TestOutSelftest(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{"archive": h.archive()})
+	h.setResults(map[string]interface{}{"ok": 1})
+
+	res := h.step("out", map[string]interface{}{
+		"source": source,
+		"params": map[string]interface{}{"selftest": true},
+	})
+	if res.Version["selftest"] != "passed" {
+		t.Fatalf("expected passed selftest version, got %v", res.Version)
+	}
+	if len(res.Metadata) != 3 {
+		t.Fatalf("expected metadata for each selftest check, got %v", res.Metadata)
+	}
+	for _, m := range res.Metadata {
+		if !strings.HasPrefix(m.Value, "ok") {
+			t.Errorf("expected selftest %s to pass, got %s", m.Name, m.Value)
+		}
+	}
+
+	// steampipe failures fail the step
+	_, stderr, err := h.exec("out", map[string]interface{}{
+		"source": source,
+		"params": map[string]interface{}{"selftest": true},
+	}, "STEAMPIPE_STUB_EXIT=1")
+	if err == nil || !strings.Contains(string(stderr), "selftest failed: plugins, query") {
+		t.Fatalf("expected selftest failure, got %v\n%s", err, stderr)
+	}
+}
+
+func TestOutScan(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"scan_interval": "1h",
+		"snapshots":     h.s3("snapshots"),
+	})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	res := h.step("out", map[string]interface{}{
+		"source": source,
+		"params": map[string]interface{}{"scan": true},
+	})
+	if res.Version["id"] != "a" {
+		t.Fatalf("expected version with id a, got %v", res.Version)
+	}
+	if len(res.Metadata) == 0 || res.Metadata[0].Name != "scanned_at" {
+		t.Fatalf("expected scanned_at metadata, got %v", res.Metadata)
+	}
+
+	// the scan defers the next query of the polling check
+	h.check(source, res.Version)
+	if n := h.queries(); n != 1 {
+		t.Fatalf("expected 1 query within scan interval, got %d", n)
+	}
+}
+
+func TestOutOrchestrate(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{
+		"query":          "select * from stub where region = {{ quote .target }}",
+		"query_template": true,
+	})
+
+	h.setResults(map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"})
+	res := h.step("out", map[string]interface{}{
+		"source": source,
+		"params": map[string]interface{}{
+			"orchestrate": map[string]interface{}{
+				"values": []string{"us-east-1", "us-west-2"},
+			},
+		},
+	})
+	if res.Version["targets"] != "2" || res.Version["rows"] != "4" || res.Version["failed"] != "0" {
+		t.Fatalf("unexpected orchestration version: %v", res.Version)
+	}
+	if n := h.queries(); n != 2 {
+		t.Fatalf("expected 1 query per target, got %d", n)
+	}
+
+	// verify consolidated report and per-target results
+	b, err := ioutil.ReadFile(filepath.Join(h.dir, "out", "report.json"))
+	if err != nil {
+		t.Fatalf("error reading report: %v", err)
+	}
+	var report struct {
+		Targets []struct {
+			File   string `json:"file"`
+			Status string `json:"status"`
+			Target string `json:"target"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("error parsing report: %v", err)
+	}
+	if len(report.Targets) != 2 || report.Targets[1].Target != "us-west-2" {
+		t.Fatalf("unexpected report: %s", b)
+	}
+	for _, target := range report.Targets {
+		if target.Status != "ok" {
+			t.Errorf("expected target %s to succeed, got %s", target.Target, target.Status)
+		}
+		if _, err := os.Stat(filepath.Join(h.dir, "out", target.File)); err != nil {
+			t.Errorf("expected results of target %s: %v", target.Target, err)
+		}
+	}
+}
+
+func TestInQuerySnapshot(t *testing.T) {
+	h := newHarness(t)
+	h.setResults(map[string]interface{}{"id": "a"})
+
+	h.step("in", map[string]interface{}{
+		"source":  h.source(nil),
+		"version": map[string]interface{}{"id": "a"},
+		"params":  map[string]interface{}{"snapshot": true},
+	})
+	if _, err := os.Stat(filepath.Join(h.dir, "in", "snapshot.sps")); err != nil {
+		t.Fatalf("expected snapshot.sps: %v", err)
+	}
+}
+
+func TestOutUploadArtifacts(t *testing.T) {
+	h := newHarness(t)
+	source := h.source(map[string]interface{}{"archive": h.archive()})
+
+	h.setResults(map[string]interface{}{"id": "a"})
+	res := h.step("out", map[string]interface{}{
+		"source": source,
+		"params": map[string]interface{}{
+			"orchestrate":      map[string]interface{}{"values": []string{"a", "b"}},
+			"upload_artifacts": true,
+		},
+	})
+
+	// report.json, results.json, and one results file per target
+	meta := make(map[string]string)
+	for _, m := range res.Metadata {
+		meta[m.Name] = m.Value
+	}
+	if meta["artifacts_uploaded"] != "4" {
+		t.Fatalf("expected 4 uploaded artifacts, got %v", res.Metadata)
+	}
+	if !strings.HasPrefix(meta["artifacts"], "s3://e2e/"+h.prefix+"/artifacts/") {
+		t.Fatalf("expected artifacts alongside archive, got %s", meta["artifacts"])
+	}
+}
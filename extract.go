@@ -0,0 +1,74 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// extractTarball extracts a gzipped tarball into the given directory, writing
+// regular files with the given permissions if specified (or the permissions
+// recorded in the archive) and skipping links and special files, where the
+// total extracted size is limited to the given maximum
+func extractTarball(r io.Reader, dir string, max int, mode *os.FileMode, debug bool) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error decompressing archive: %v", err)
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory '%s': %v", dir, err)
+	}
+
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+
+		// reject entries that escape the target directory
+		name := filepath.Clean(filepath.FromSlash(h.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid archive entry '%s': path escapes target directory", h.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("error creating directory '%s': %v", target, err)
+			}
+		case tar.TypeReg:
+			total += h.Size
+			if total > int64(max) {
+				return fmt.Errorf("archive exceeds maximum extracted size of %d bytes", max)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("error creating directory '%s': %v", filepath.Dir(target), err)
+			}
+			perm := os.FileMode(h.Mode).Perm()
+			if mode != nil {
+				perm = *mode
+			}
+			if err := writeFile(target, io.LimitReader(tr, h.Size), perm); err != nil {
+				return fmt.Errorf("error writing '%s': %v", target, err)
+			}
+		default:
+			if debug {
+				color.Yellow("skipping unsupported archive entry: %s", h.Name)
+			}
+		}
+	}
+}
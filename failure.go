@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// maxFailureStderr defines the maximum number of trailing stderr bytes
+// included in a failure report
+const maxFailureStderr = 2048
+
+// defaultRetryDelay defines the default delay between retried commands
+const defaultRetryDelay = 5 * time.Second
+
+// supported error classes
+const (
+	errorConfig  = "config"
+	errorPlugin  = "plugin"
+	errorQuery   = "query"
+	errorService = "service"
+	errorTimeout = "timeout"
+	errorUnknown = "unknown"
+)
+
+// defaultRetryClasses defines the error classes retried by default, which
+// are typically transient
+var defaultRetryClasses = []string{errorPlugin, errorService, errorTimeout}
+
+// stages maps steampipe subcommands to the resource stage they implement
+var stages = map[string]string{
+	"check":     "benchmark",
+	"dashboard": "snapshot",
+	"plugin":    "plugin",
+	"query":     "query",
+	"service":   "service",
+}
+
+// exitCodes maps documented steampipe exit codes to error classes
+var exitCodes = map[int]string{
+	11:  errorPlugin,
+	12:  errorPlugin,
+	31:  errorService,
+	32:  errorService,
+	33:  errorService,
+	41:  errorQuery,
+	250: errorConfig,
+	251: errorService,
+	252: errorConfig,
+	253: errorConfig,
+	254: errorConfig,
+}
+
+// stderrPatterns maps known stderr fragments to error classes, in order of
+// precedence, for failures without a specific exit code
+var stderrPatterns = []struct {
+	class    string
+	patterns []string
+}{
+	{errorTimeout, []string{"context deadline exceeded", "timed out", "timeout"}},
+	{errorConfig, []string{"failed to load config", "connection config", ".spc"}},
+	{errorPlugin, []string{"plugin not found", "failed to start plugin", "plugin manager", "plugin exited"}},
+	{errorService, []string{"steampipe service", "failed to start the database", "database is not running"}},
+	{errorQuery, []string{"syntax error", "does not exist", "invalid input syntax"}},
+}
+
+type (
+	// Retry describes how failed steampipe commands are retried
+	Retry struct {
+		Attempts int      `json:"attempts" validate:"gte=0"`
+		Delay    string   `json:"delay"`
+		On       []string `json:"on" validate:"omitempty,dive,oneof=config plugin query service timeout unknown"`
+	}
+
+	// steampipeError describes a failed steampipe command and its class
+	steampipeError struct {
+		Class    string
+		ExitCode int
+		err      error
+	}
+
+	// failure describes the most recent failed steampipe command, which is
+	// reported alongside the error of a failed operation since concourse does
+	// not display metadata for failed steps
+	failure struct {
+		Stage    string
+		Class    string
+		Command  string
+		ExitCode int
+		Retries  int
+		Stderr   string
+	}
+)
+
+func (e *steampipeError) Error() string {
+	return fmt.Sprintf("%s error (exit code %d): %v", e.Class, e.ExitCode, e.err)
+}
+
+func (e *steampipeError) Unwrap() error {
+	return e.err
+}
+
+// next returns whether a failure of the given class should be retried after
+// the given zero-based attempt, and the delay prior to retrying
+func (r *Retry) next(class string, attempt int) (bool, time.Duration, error) {
+	if r == nil || attempt >= r.Attempts {
+		return false, 0, nil
+	}
+	delay := defaultRetryDelay
+	if r.Delay != "" {
+		d, err := time.ParseDuration(r.Delay)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid retry delay: %v", err)
+		}
+		delay = d
+	}
+	classes := r.On
+	if len(classes) == 0 {
+		classes = defaultRetryClasses
+	}
+	for _, c := range classes {
+		if c == class {
+			return true, delay, nil
+		}
+	}
+	return false, 0, nil
+}
+
+// exitCode returns the exit code of a failed command, or -1 if the command
+// did not exit
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// classify returns the class of a failed steampipe command based on its exit
+// code and stderr output, or an empty string if the exit code does not
+// indicate a failure (e.g. controls in alarm or error)
+func classify(ctx context.Context, args []string, stderr []byte, err error) string {
+	if ctx.Err() != nil {
+		return errorTimeout
+	}
+	code := exitCode(err)
+	if len(args) > 0 && args[0] == "check" && (code == 1 || code == 2) {
+		return ""
+	}
+	if class, ok := exitCodes[code]; ok {
+		return class
+	}
+	msg := strings.ToLower(string(stderr))
+	for _, p := range stderrPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(msg, pattern) {
+				return p.class
+			}
+		}
+	}
+	return errorUnknown
+}
+
+// skipError returns whether the class of the most recent failure is one of
+// the configured classes of errors that checks skip
+func (r *Resource) skipError(s *Source) bool {
+	r.fmu.Lock()
+	f := r.failure
+	r.fmu.Unlock()
+	if f == nil {
+		return false
+	}
+	for _, c := range s.SkipErrors {
+		if c == f.Class {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a failed steampipe command as the most recent failure
+func (r *Resource) fail(args []string, stderr []byte, err *steampipeError, retries int) {
+	f := &failure{
+		Stage:    "steampipe",
+		Class:    err.Class,
+		Command:  strings.Join(args, " "),
+		ExitCode: err.ExitCode,
+		Retries:  retries,
+		Stderr:   strings.TrimSpace(string(stderr)),
+	}
+	if len(args) > 0 {
+		if stage, ok := stages[args[0]]; ok {
+			f.Stage = stage
+		}
+	}
+	if n := len(f.Stderr); n > maxFailureStderr {
+		f.Stderr = "..." + f.Stderr[n-maxFailureStderr:]
+	}
+
+	r.fmu.Lock()
+	defer r.fmu.Unlock()
+	r.failure = f
+}
+
+// reportFailure writes the most recent failed steampipe command, if any, to
+// the given writer
+func (r *Resource) reportFailure(w io.Writer) {
+	r.fmu.Lock()
+	f := r.failure
+	r.fmu.Unlock()
+	if f == nil {
+		return
+	}
+
+	c := color.New(color.FgRed)
+	c.Fprintln(w, "last steampipe failure:")
+	c.Fprintf(w, "  stage:     %s\n", f.Stage)
+	c.Fprintf(w, "  class:     %s\n", f.Class)
+	c.Fprintf(w, "  command:   %s\n", f.Command)
+	c.Fprintf(w, "  exit code: %d\n", f.ExitCode)
+	c.Fprintf(w, "  retries:   %d\n", f.Retries)
+	if f.Stderr != "" {
+		c.Fprintf(w, "  stderr:\n    %s\n", strings.ReplaceAll(f.Stderr, "\n", "\n    "))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+// FileOptions describes the encoding, ownership, and permissions of a
+// supporting file, for plugins and tools that enforce permission checks (e.g.
+// ssh, kubectl), or a remote location its content is downloaded from
+type FileOptions struct {
+	Encoding string            `json:"encoding" validate:"omitempty,oneof=base64"`
+	Extract  bool              `json:"extract"`
+	GCS      *GCSFile          `json:"gcs" validate:"omitempty"`
+	Group    string            `json:"group"`
+	Headers  map[string]string `json:"headers"`
+	Mode     string            `json:"mode"`
+	Owner    string            `json:"owner"`
+	S3       *S3File           `json:"s3" validate:"omitempty"`
+	SHA256   string            `json:"sha256" validate:"omitempty,len=64,hexadecimal"`
+	URL      string            `json:"url" validate:"omitempty,url"`
+}
+
+// S3File describes a file downloaded from an s3 object, using the same
+// configuration and credentials as other s3 stores
+type S3File struct {
+	blob.Config
+	Key     string `json:"key" validate:"required"`
+	Version string `json:"version"`
+}
+
+// GCSFile describes a file downloaded from a gcs object
+type GCSFile struct {
+	AccessToken string `json:"access_token"`
+	Bucket      string `json:"bucket" validate:"required"`
+	Generation  string `json:"generation"`
+	Object      string `json:"object" validate:"required"`
+}
+
+const (
+	// defaultFileMode defines the default permissions of configuration and
+	// supporting files, which commonly contain credentials
+	defaultFileMode os.FileMode = 0600
+
+	// artifactFileMode defines the permissions of files written to get and
+	// put step directories
+	artifactFileMode os.FileMode = 0644
+
+	// defaultMaxFileBytes defines the default maximum size of a single
+	// supporting file
+	defaultMaxFileBytes = 10 << 20
+)
+
+// systemPaths defines directories that supporting files are never written
+// to, regardless of whether absolute paths are allowed
+var systemPaths = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/proc", "/sbin", "/sys", "/usr"}
+
+// extractMode returns the explicitly configured permissions of files
+// extracted from a tarball, if any
+func (o FileOptions) extractMode() (*os.FileMode, error) {
+	if o.Mode == "" {
+		return nil, nil
+	}
+	mode, err := parseFileMode("file_options mode", o.Mode)
+	return &mode, err
+}
+
+// fileMode returns the configured permissions of the named supporting file,
+// which default to the source file mode
+func fileMode(s *Source, name string) (os.FileMode, error) {
+	if o, ok := s.FileOptions[name]; ok && o.Mode != "" {
+		return parseFileMode("file_options mode", o.Mode)
+	}
+	if s.FileMode == "" {
+		return defaultFileMode, nil
+	}
+	return parseFileMode("file_mode", s.FileMode)
+}
+
+// parseFileMode parses octal file permissions
+func parseFileMode(field, value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid %s '%s': expected octal permissions (e.g. 0640)", field, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// chownFile applies the configured owner and group of the named supporting
+// file, if any, which are either names or numeric ids and require the
+// resource to run as root or with CAP_CHOWN
+func chownFile(s *Source, name, f string) error {
+	o, ok := s.FileOptions[name]
+	if !ok || (o.Owner == "" && o.Group == "") {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	if o.Owner != "" {
+		id := o.Owner
+		if _, err := strconv.Atoi(id); err != nil {
+			u, err := user.Lookup(o.Owner)
+			if err != nil {
+				return fmt.Errorf("error resolving owner of file '%s': %v", name, err)
+			}
+			id = u.Uid
+		}
+		uid, _ = strconv.Atoi(id)
+	}
+	if o.Group != "" {
+		id := o.Group
+		if _, err := strconv.Atoi(id); err != nil {
+			g, err := user.LookupGroup(o.Group)
+			if err != nil {
+				return fmt.Errorf("error resolving group of file '%s': %v", name, err)
+			}
+			id = g.Gid
+		}
+		gid, _ = strconv.Atoi(id)
+	}
+
+	if err := os.Chown(f, uid, gid); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("error changing ownership of file '%s': requires running as root or with CAP_CHOWN: %v", name, err)
+		}
+		return fmt.Errorf("error changing ownership of file '%s': %v", name, err)
+	}
+	return nil
+}
+
+// maxFileBytes returns the configured maximum size of a supporting file
+func maxFileBytes(s *Source) int {
+	if s.MaxFileBytes > 0 {
+		return s.MaxFileBytes
+	}
+	return defaultMaxFileBytes
+}
+
+// writeFile streams the given content to the named file with the given
+// permissions, which are applied to existing files as well
+func writeFile(name string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fileContent returns a reader of the decoded content of the named supporting
+// file and its decoded size, where base64 content may contain whitespace
+// (e.g. line wrapping) and is decoded as it is written
+func fileContent(s *Source, name, content string) (io.Reader, int) {
+	if o := s.FileOptions[name]; o.Encoding != "base64" {
+		return strings.NewReader(content), len(content)
+	}
+	encoded := strings.Join(strings.Fields(content), "")
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded))
+	return decoder, base64.StdEncoding.DecodedLen(len(encoded))
+}
+
+// resolveFile resolves the destination of a supporting file, where relative
+// paths are resolved against the working directory and ~/ against the home
+// directory; destinations must not contain .. components, must be within the
+// working or home directory (unless absolute paths are allowed), must not be
+// reached via symlinks that escape these directories, and are never system
+// paths
+func resolveFile(s *Source, name string) (string, error) {
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid file '%s': path must not contain '..'", name)
+		}
+	}
+
+	wd, err := workDir(s)
+	if err != nil {
+		return "", fmt.Errorf("error resolving working directory: %v", err)
+	}
+	f := name
+	switch {
+	case strings.HasPrefix(f, "~/"):
+		f = filepath.Join(homeDir(s), f[2:])
+	case !filepath.IsAbs(f):
+		f = filepath.Join(wd, f)
+	}
+	f = filepath.Clean(f)
+
+	for _, p := range systemPaths {
+		if f == p || strings.HasPrefix(f, p+"/") {
+			return "", fmt.Errorf("invalid file '%s': writing to system path '%s' is not allowed", name, p)
+		}
+	}
+	if info, err := os.Lstat(f); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("invalid file '%s': destination is a symlink", name)
+	}
+	if s.AllowAbsolutePaths {
+		return f, nil
+	}
+
+	roots := []string{wd, homeDir(s)}
+	if !within(f, roots) {
+		return "", fmt.Errorf("invalid file '%s': destination must be within the working or home directory unless allow_absolute_paths is enabled", name)
+	}
+
+	// resolve symlinks in the nearest existing ancestor, which must remain
+	// within a resolved root
+	ancestor := filepath.Dir(f)
+	for {
+		if _, err := os.Lstat(ancestor); err == nil || ancestor == filepath.Dir(ancestor) {
+			break
+		}
+		ancestor = filepath.Dir(ancestor)
+	}
+	resolved, err := filepath.EvalSymlinks(ancestor)
+	if err != nil {
+		return "", fmt.Errorf("error resolving file '%s': %v", name, err)
+	}
+	resolvedRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			resolvedRoots = append(resolvedRoots, r)
+		}
+	}
+	if !within(resolved, resolvedRoots) {
+		return "", fmt.Errorf("invalid file '%s': destination escapes the working and home directories via a symlink", name)
+	}
+	return f, nil
+}
+
+// within returns whether the path is any of the given roots or is contained
+// by one of them
+func within(p string, roots []string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, p)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveFile(t *testing.T) {
+	dir := t.TempDir()
+	work, home, outside := filepath.Join(dir, "work"), filepath.Join(dir, "home"), filepath.Join(dir, "outside")
+	for _, d := range []string{work, home, outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(work, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target.txt"), filepath.Join(work, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		file     string
+		absolute bool
+		want     string
+		err      string
+	}{
+		{
+			name: "relative",
+			file: "config/aws.txt",
+			want: filepath.Join(work, "config", "aws.txt"),
+		},
+		{
+			name: "home",
+			file: "~/.aws/credentials",
+			want: filepath.Join(home, ".aws", "credentials"),
+		},
+		{
+			name: "absolute within working directory",
+			file: filepath.Join(work, "aws.txt"),
+			want: filepath.Join(work, "aws.txt"),
+		},
+		{
+			name: "parent",
+			file: "../secret.txt",
+			err:  "path must not contain '..'",
+		},
+		{
+			name: "nested parent",
+			file: "config/../../secret.txt",
+			err:  "path must not contain '..'",
+		},
+		{
+			name: "home parent",
+			file: "~/../secret.txt",
+			err:  "path must not contain '..'",
+		},
+		{
+			name: "absolute outside",
+			file: filepath.Join(outside, "aws.txt"),
+			err:  "destination must be within the working or home directory",
+		},
+		{
+			name:     "absolute outside allowed",
+			file:     filepath.Join(outside, "aws.txt"),
+			absolute: true,
+			want:     filepath.Join(outside, "aws.txt"),
+		},
+		{
+			name:     "system path",
+			file:     "/etc/passwd",
+			absolute: true,
+			err:      "writing to system path '/etc' is not allowed",
+		},
+		{
+			name:     "nested system path",
+			file:     "/usr/local/bin/steampipe",
+			absolute: true,
+			err:      "writing to system path '/usr' is not allowed",
+		},
+		{
+			name: "system path without absolute paths",
+			file: "/proc/self/environ",
+			err:  "writing to system path '/proc' is not allowed",
+		},
+		{
+			name: "symlink directory escape",
+			file: "escape/aws.txt",
+			err:  "escapes the working and home directories via a symlink",
+		},
+		{
+			name: "nested symlink directory escape",
+			file: "escape/config/aws.txt",
+			err:  "escapes the working and home directories via a symlink",
+		},
+		{
+			name:     "symlink destination",
+			file:     "link.txt",
+			absolute: true,
+			err:      "destination is a symlink",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Source{AllowAbsolutePaths: c.absolute, Home: home, WorkDir: work}
+			got, err := resolveFile(s, c.file)
+			switch {
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing '%s', got %v", c.err, err)
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case got != c.want:
+				t.Fatalf("expected '%s', got '%s'", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// invalidConnectionChars matches characters not permitted in steampipe
+// connection names
+var invalidConnectionChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// GCP describes google cloud application default credentials and the gcp
+// plugin connections generated per project
+type GCP struct {
+	Aggregator                bool     `json:"aggregator"`
+	ConnectionPrefix          string   `json:"connection_prefix"`
+	Credentials               string   `json:"credentials" validate:"required"`
+	ImpersonateServiceAccount string   `json:"impersonate_service_account"`
+	Projects                  []string `json:"projects"`
+}
+
+// gcpCredentialsFile returns the path of the application default credentials
+// file
+func gcpCredentialsFile(s *Source) string {
+	return path.Join(homeDir(s), ".config", "gcloud", "application_default_credentials.json")
+}
+
+// writeGCP writes the application default credentials, which are either a
+// service account key or an external account (workload identity federation)
+// configuration, along with the generated gcp connections
+func writeGCP(s *Source) error {
+	var creds struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(s.GCP.Credentials), &creds); err != nil {
+		return fmt.Errorf("invalid gcp credentials: %v", err)
+	}
+	switch creds.Type {
+	case "service_account", "external_account", "authorized_user", "impersonated_service_account":
+	default:
+		return fmt.Errorf("invalid gcp credentials: unsupported type '%s'", creds.Type)
+	}
+
+	f := gcpCredentialsFile(s)
+	if err := os.MkdirAll(path.Dir(f), 0700); err != nil {
+		return fmt.Errorf("error creating gcloud directory: %v", err)
+	}
+	if err := writeFile(f, strings.NewReader(s.GCP.Credentials), defaultFileMode); err != nil {
+		return fmt.Errorf("error writing gcp credentials: %v", err)
+	}
+
+	if len(s.GCP.Projects) > 0 {
+		if err := writeFile(path.Join(configDir(s), "gcp.spc"), strings.NewReader(renderGCPConnections(s)), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing gcp connections: %v", err)
+		}
+	}
+	return nil
+}
+
+// gcpPrefix returns the prefix of generated connection names
+func gcpPrefix(s *Source) string {
+	if s.GCP.ConnectionPrefix == "" {
+		return "gcp_"
+	}
+	return s.GCP.ConnectionPrefix
+}
+
+// gcpConnection returns the name of the connection generated for a project
+func gcpConnection(s *Source, project string) string {
+	return gcpPrefix(s) + invalidConnectionChars.ReplaceAllString(strings.ToLower(project), "_")
+}
+
+// renderGCPConnections renders a gcp connection per configured project, and
+// an aggregator connection across all of them if enabled
+func renderGCPConnections(s *Source) string {
+	var b strings.Builder
+	for _, project := range s.GCP.Projects {
+		fmt.Fprintf(&b, "connection %s {\n", strconv.Quote(gcpConnection(s, project)))
+		b.WriteString("  plugin      = \"gcp\"\n")
+		fmt.Fprintf(&b, "  project     = %s\n", strconv.Quote(project))
+		fmt.Fprintf(&b, "  credentials = %s\n", strconv.Quote(gcpCredentialsFile(s)))
+		if s.GCP.ImpersonateServiceAccount != "" {
+			fmt.Fprintf(&b, "  impersonate_service_account = %s\n", strconv.Quote(s.GCP.ImpersonateServiceAccount))
+		}
+		b.WriteString("}\n")
+	}
+	if s.GCP.Aggregator {
+		prefix := gcpPrefix(s)
+		fmt.Fprintf(&b, "connection %s {\n", strconv.Quote(strings.TrimSuffix(prefix, "_")))
+		b.WriteString("  plugin      = \"gcp\"\n")
+		b.WriteString("  type        = \"aggregator\"\n")
+		fmt.Fprintf(&b, "  connections = [%s]\n", strconv.Quote(prefix+"*"))
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
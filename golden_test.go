@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+)
+
+// update rewrites the expected output of each golden test case
+var update = flag.Bool("update", false, "update golden files")
+
+// TestGolden derives versions from each case directory in testdata/golden,
+// which contains:
+//   - source.json: the resource config, where config and writable_dir are
+//     provided by the test
+//   - results.json: the query output emitted by the stub steampipe binary
+//   - version.json: the optional previous version
+//   - expected.json: the expected new versions, if any
+//   - metadata.json: the optional expected put metadata
+func TestGolden(t *testing.T) {
+	stubs, err := filepath.Abs(filepath.Join("e2e", "testdata", "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", stubs+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cases, err := ioutil.ReadDir(filepath.Join("testdata", "golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if !c.IsDir() {
+			continue
+		}
+		dir := filepath.Join("testdata", "golden", c.Name())
+		t.Run(c.Name(), func(t *testing.T) {
+			results, err := filepath.Abs(filepath.Join(dir, "results.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("STEAMPIPE_STUB_RESULTS", results)
+			ctx := sdk.ContextWithStdErr(context.Background(), ioutil.Discard)
+
+			// derive new versions from the previous version, if any
+			var prev *Version
+			if b, err := ioutil.ReadFile(filepath.Join(dir, "version.json")); err == nil {
+				prev = &Version{}
+				if err := json.Unmarshal(b, prev); err != nil {
+					t.Fatalf("error parsing version.json: %v", err)
+				}
+			}
+			r, s := &Resource{}, goldenSource(t, ctx, dir)
+			if err := r.Initialize(ctx, s); err != nil {
+				t.Fatalf("error initializing resource: %v", err)
+			}
+			versions, err := r.Check(ctx, s, prev)
+			if err != nil {
+				t.Fatalf("error checking: %v", err)
+			}
+			if prev != nil {
+				versions = versions[1:]
+			}
+			if versions == nil {
+				versions = []Version{}
+			}
+			assertGolden(t, filepath.Join(dir, "expected.json"), versions)
+
+			// compare put metadata if expected
+			f := filepath.Join(dir, "metadata.json")
+			if _, err := os.Stat(f); err != nil && !*update {
+				return
+			}
+			r, s = &Resource{}, goldenSource(t, ctx, dir)
+			if err := r.Initialize(ctx, s); err != nil {
+				t.Fatalf("error initializing resource: %v", err)
+			}
+			_, meta, err := r.Out(ctx, s, t.TempDir(), nil)
+			if err != nil {
+				t.Fatalf("error putting: %v", err)
+			}
+			if meta == nil {
+				meta = []sdk.Metadata{}
+			}
+			assertGolden(t, f, meta)
+		})
+	}
+}
+
+// goldenSource parses and validates the source config of a golden test case
+func goldenSource(t *testing.T, ctx context.Context, dir string) *Source {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(dir, "source.json"))
+	if err != nil {
+		t.Fatalf("error reading source.json: %v", err)
+	}
+	var s Source
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("error parsing source.json: %v", err)
+	}
+	s.Config = `connection "stub" { plugin = "stub" }`
+	s.WritableDir = t.TempDir()
+	if err := s.Validate(ctx); err != nil {
+		t.Fatalf("invalid source.json: %v", err)
+	}
+	return &s
+}
+
+// assertGolden compares the json serialization of a value against a golden
+// file, or rewrites the golden file when -update is specified
+func assertGolden(t *testing.T, f string, v interface{}) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("error serializing %s: %v", filepath.Base(f), err)
+	}
+	if *update {
+		if err := ioutil.WriteFile(f, append(got, '\n'), 0644); err != nil {
+			t.Fatalf("error updating %s: %v", filepath.Base(f), err)
+		}
+		return
+	}
+
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", filepath.Base(f), err)
+	}
+	var want, actual interface{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatalf("error parsing %s: %v", filepath.Base(f), err)
+	}
+	if err := json.Unmarshal(got, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, actual) {
+		t.Errorf("%s mismatch (run with -update to accept)\nwant: %s\ngot:  %s", filepath.Base(f), b, got)
+	}
+}
@@ -8,7 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"sort"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -18,22 +22,48 @@ import (
 )
 
 type Config struct {
-	Type  string `json:"type" validate:"omitempty,oneof=empty s3"`
-	Debug bool
+	Type  string    `json:"type" validate:"omitempty,oneof=empty s3"`
+	Debug bool      `json:"debug"`
 	S3    *S3Config `json:"s3,omitempty" validate:"omitempty,required_if=Type s3,dive"`
+
+	// ConfigHash is an optional hash of the resource configuration, populated
+	// by the resource rather than user configuration, that is recorded
+	// alongside each archived version
+	ConfigHash string `json:"-"`
+
+	// Quiet omits archived version data from debug logging, populated by the
+	// resource for results containing sensitive data
+	Quiet bool `json:"-"`
 }
 
 type Archive interface {
 	History(context.Context) ([][]byte, error)
+	Latest(context.Context) ([]byte, error)
+	Prune(ctx context.Context, keep int) error
 	Put(context.Context, interface{}) error
+
+	// Export and Import read and write archived objects as stored, including
+	// any envelope, such that objects can be copied between archives without
+	// altering their original timestamp or provenance
+	Export(context.Context) ([][]byte, error)
+	Import(ctx context.Context, objects ...[]byte) error
 }
 
-func New(ctx context.Context, cfg *Config) (Archive, error) {
+// New initializes an archive from the given config, where debug enables
+// debug logging regardless of the archive's own debug setting (e.g. when
+// source.debug is enabled)
+func New(ctx context.Context, cfg *Config, debug bool) (Archive, error) {
 	switch cfg.Type {
 	case "", "empty":
 		return &Empty{}, nil
 	case "s3":
-		return NewS3(ctx, cfg.S3, cfg.Debug)
+		a, err := NewS3(ctx, cfg.S3, cfg.Debug || debug)
+		if err != nil {
+			return nil, err
+		}
+		a.configHash = cfg.ConfigHash
+		a.quiet = cfg.Quiet
+		return a, nil
 	default:
 		return nil, fmt.Errorf("unsupported type: %s", cfg.Type)
 	}
@@ -47,19 +77,54 @@ func (a *Empty) History(context.Context) ([][]byte, error) {
 	return nil, nil
 }
 
+func (a *Empty) Latest(context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+func (a *Empty) Prune(context.Context, int) error {
+	return nil
+}
+
 func (a *Empty) Put(context.Context, interface{}) error {
 	return nil
 }
 
+func (a *Empty) Export(context.Context) ([][]byte, error) {
+	return nil, nil
+}
+
+func (a *Empty) Import(context.Context, ...[]byte) error {
+	return nil
+}
+
 // =============================================================================
 
+// defaultPageSize defines the default number of object versions retrieved
+// per list request, which is the maximum supported by S3
+const defaultPageSize = 1000
+
+// keyTimestampFormat defines the format of the timestamp available to key
+// templates, which sorts chronologically
+const keyTimestampFormat = "20060102T150405.000000Z"
+
+// defaultDedupLookback defines the default number of recent versions scanned
+// for duplicates prior to archiving a new version
+const defaultDedupLookback = 100
+
 type (
 	S3Config struct {
-		Bucket      string         `json:"bucket" validate:"required"`
-		Key         string         `json:"key" validate:"required"`
-		Region      string         `json:"region" validate:"required"`
-		MaxVersions int            `json:"max_versions"`
-		Credentials *S3Credentials `json:"credentials,omitempty" validate:"omitempty,dive"`
+		Bucket        string         `json:"bucket" validate:"required"`
+		Endpoint      string         `json:"endpoint"`
+		Key           string         `json:"key" validate:"required_without=KeyTemplate"`
+		KeyTemplate   string         `json:"key_template" validate:"excluded_with=Key"`
+		Unversioned   string         `json:"unversioned" validate:"omitempty,oneof=fail per_version"`
+		Region        string         `json:"region" validate:"required"`
+		MaxVersions   int            `json:"max_versions"`
+		PageSize      int            `json:"page_size" validate:"gte=0,lte=1000"`
+		DedupLookback int            `json:"dedup_lookback" validate:"gte=0"`
+		Credentials   *S3Credentials `json:"credentials,omitempty" validate:"omitempty,dive"`
+		Scope         *Scope         `json:"scope,omitempty"`
+		Namespace     *Namespace     `json:"namespace,omitempty"`
 	}
 
 	S3Credentials struct {
@@ -69,12 +134,15 @@ type (
 	}
 
 	S3 struct {
-		cfg     *S3Config
-		client  *s3.Client
-		debug   bool
-		sums    map[string]struct{}
-		fetched bool
-		m       sync.Mutex
+		cfg        *S3Config
+		client     *s3.Client
+		configHash string
+		debug      bool
+		quiet      bool
+		sums       map[string]struct{}
+		fetched    bool
+		keyTmpl    *template.Template
+		m          sync.Mutex
 	}
 )
 
@@ -91,19 +159,99 @@ func NewS3(ctx context.Context, cfg *S3Config, debug bool) (*S3, error) {
 		return nil, fmt.Errorf("error loading aws config: %v", err)
 	}
 
-	return &S3{
+	// scope archive keys to the pipeline instance and prefix them with the
+	// team and pipeline namespace if configured
+	segment, err := cfg.Scope.segment()
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := cfg.Namespace.prefix()
+	if err != nil {
+		return nil, err
+	}
+	if segment != "" || namespace != "" {
+		scoped := *cfg
+		if cfg.Key != "" {
+			scoped.Key = namespace + scopeKey(cfg.Key, segment)
+		}
+		if cfg.KeyTemplate != "" {
+			scoped.KeyTemplate = namespace + scopeKey(cfg.KeyTemplate, segment)
+		}
+		cfg = &scoped
+	}
+
+	var s3opts []func(*s3.Options)
+	if cfg.Endpoint != "" {
+		s3opts = append(s3opts,
+			s3.WithEndpointResolver(s3.EndpointResolverFromURL(cfg.Endpoint)),
+			func(o *s3.Options) {
+				o.UsePathStyle = true
+			},
+		)
+	}
+
+	a := &S3{
 		cfg:    cfg,
-		client: s3.NewFromConfig(sess),
+		client: s3.NewFromConfig(sess, s3opts...),
 		debug:  debug,
 		sums:   make(map[string]struct{}),
 		m:      sync.Mutex{},
-	}, nil
+	}
+
+	// the single-key archive relies on bucket versioning to retain history
+	if cfg.KeyTemplate == "" {
+		if err := a.checkVersioning(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// parse per-version key template if configured
+	if a.cfg.KeyTemplate != "" {
+		if a.keyTmpl, err = template.New("key").Option("missingkey=error").Parse(a.cfg.KeyTemplate); err != nil {
+			return nil, fmt.Errorf("error parsing key template: %v", err)
+		}
+	}
+	return a, nil
+}
+
+// checkVersioning verifies that versioning is enabled on the archive bucket,
+// either failing or switching to per-version keys depending on configuration,
+// as overwriting a single key in an unversioned bucket silently loses history
+func (a *S3) checkVersioning(ctx context.Context) error {
+	out, err := a.client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: &a.cfg.Bucket,
+	})
+	if err != nil {
+		return fmt.Errorf("error retrieving bucket versioning configuration: %v", err)
+	}
+	if out.Status == types.BucketVersioningStatusEnabled {
+		return nil
+	}
+
+	if a.cfg.Unversioned != "per_version" {
+		return fmt.Errorf("versioning is not enabled on bucket '%s', which is required to retain archive history for a single key; enable bucket versioning, configure key_template, or set unversioned to per_version", a.cfg.Bucket)
+	}
+
+	cfg := *a.cfg
+	cfg.KeyTemplate = strings.TrimSuffix(cfg.Key, "/") + "/{{ .timestamp }}-{{ .digest }}.json"
+	cfg.Key = ""
+	a.cfg = &cfg
+	color.Yellow("versioning is not enabled on bucket '%s', archiving versions under per-version keys: %s", cfg.Bucket, cfg.KeyTemplate)
+	return nil
 }
 
 func (a *S3) History(ctx context.Context) (versions [][]byte, err error) {
 	a.m.Lock()
 	defer a.m.Unlock()
-	return a.history(ctx)
+	return a.history(ctx, a.cfg.MaxVersions, false)
+}
+
+// Export returns the full history as stored, oldest first, skipping objects
+// that fail verification
+func (a *S3) Export(ctx context.Context) ([][]byte, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.history(ctx, 0, true)
 }
 
 func (a *S3) Put(ctx context.Context, v interface{}) error {
@@ -115,98 +263,364 @@ func (a *S3) Put(ctx context.Context, v interface{}) error {
 		return fmt.Errorf("error serializing version json: %v", err)
 	}
 
-	// fetch recent history
+	// fetch recent history for deduplication
 	if !a.fetched {
-		a.cfg.MaxVersions = 100
-		_, err := a.history(ctx)
-		if err != nil {
+		if _, err := a.history(ctx, a.dedupLookback(), false); err != nil {
 			return fmt.Errorf("error fetching history: %v", err)
 		}
 	}
 
-	sumb := md5.Sum(b)
-	sum := hex.EncodeToString(sumb[:])
+	sum := versionSum(b)
 	if _, ok := a.sums[sum]; ok {
 		a.log("skipping archival of existing version: %s", sum)
+		return nil
+	}
+
+	sealed, err := seal(b, a.configHash)
+	if err != nil {
+		return err
+	}
+	return a.putObject(ctx, sum, sealed)
+}
+
+// Import archives the given objects as is, oldest first, skipping objects
+// containing a version that was previously archived
+func (a *S3) Import(ctx context.Context, objects ...[]byte) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if !a.fetched {
+		if _, err := a.history(ctx, a.dedupLookback(), false); err != nil {
+			return fmt.Errorf("error fetching history: %v", err)
+		}
+	}
+
+	for _, obj := range objects {
+		version, err := unseal(obj)
+		if err != nil {
+			return fmt.Errorf("error verifying object: %v", err)
+		}
+		sum := versionSum(version)
+		if _, ok := a.sums[sum]; ok {
+			a.log("skipping import of existing version: %s", sum)
+			continue
+		}
+		if err := a.putObject(ctx, sum, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putObject writes an archived object for the version with the given sum
+func (a *S3) putObject(ctx context.Context, sum string, body []byte) error {
+	key, err := a.key(sum)
+	if err != nil {
+		return err
 	}
 
 	params := &s3.PutObjectInput{
 		Bucket: &a.cfg.Bucket,
-		Key:    &a.cfg.Key,
-		Body:   bytes.NewReader(b),
+		Key:    &key,
+		Body:   bytes.NewReader(body),
+	}
+
+	start := time.Now()
+	if _, err = a.client.PutObject(ctx, params); err != nil {
+		return err
+	}
+	a.log("archived version (%d bytes) to s3://%s/%s in %s", len(body), a.cfg.Bucket, key, time.Since(start))
+	a.sums[sum] = struct{}{}
+	return nil
+}
+
+// versionSum returns the deduplication sum of the serialized version, which
+// is compacted so that formatting does not affect deduplication
+func versionSum(version []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, version); err == nil {
+		version = buf.Bytes()
 	}
+	sum := md5.Sum(version)
+	return hex.EncodeToString(sum[:])
+}
 
-	_, err = a.client.PutObject(ctx, params)
-	return err
+// dedupLookback returns the number of recent versions scanned for duplicates
+// prior to archiving a new version
+func (a *S3) dedupLookback() int {
+	if a.cfg.DedupLookback > 0 {
+		return a.cfg.DedupLookback
+	}
+	return defaultDedupLookback
 }
 
-func (a *S3) history(ctx context.Context) (versions [][]byte, err error) {
+// Latest returns the most recently archived version, if any, without
+// retrieving the full history
+func (a *S3) Latest(ctx context.Context) ([]byte, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// return the most recent version that passes verification
+	var latest []byte
+	var err error
+	lerr := a.listVersions(ctx, false, func(item types.ObjectVersion) bool {
+		body, derr := a.downloadObjectVersion(ctx, &item)
+		if derr != nil {
+			err = derr
+			return false
+		}
+		if latest, derr = a.unseal(&item, body); derr != nil {
+			return true
+		}
+		return false
+	})
+	if lerr != nil {
+		return nil, lerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// Prune permanently deletes all but the most recent keep archived versions
+func (a *S3) Prune(ctx context.Context, keep int) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// collect all versions of the archive key, which are returned newest first
+	var stale []types.ObjectIdentifier
 	var n int
+	err := a.listVersions(ctx, true, func(item types.ObjectVersion) bool {
+		if n++; n > keep {
+			stale = append(stale, types.ObjectIdentifier{Key: item.Key, VersionId: item.VersionId})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
 
-	params := &s3.ListObjectVersionsInput{
-		Bucket: &a.cfg.Bucket,
-		Prefix: &a.cfg.Key,
+	// delete stale versions in batches of the maximum supported size
+	for len(stale) > 0 {
+		batch := stale
+		if len(batch) > 1000 {
+			batch = batch[:1000]
+		}
+		stale = stale[len(batch):]
+
+		a.log("pruning %d archived versions...", len(batch))
+		out, err := a.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &a.cfg.Bucket,
+			Delete: &types.Delete{Objects: batch, Quiet: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error pruning archived versions: %v", err)
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("error pruning archived versions: %d versions could not be deleted", len(out.Errors))
+		}
 	}
-	if max := a.cfg.MaxVersions; max > 0 && max < 1000 {
-		params.MaxKeys = int32(max)
+	return nil
+}
+
+// key returns the object key for a new version with the given sum, which is
+// either the static key or the rendered key template
+func (a *S3) key(sum string) (string, error) {
+	if a.keyTmpl == nil {
+		return a.cfg.Key, nil
 	}
+	var b strings.Builder
+	err := a.keyTmpl.Execute(&b, map[string]interface{}{
+		"digest":    sum,
+		"timestamp": time.Now().UTC().Format(keyTimestampFormat),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error rendering key template: %v", err)
+	}
+	return b.String(), nil
+}
 
+// prefix returns the static key prefix shared by all archived objects
+func (a *S3) prefix() string {
+	if a.keyTmpl == nil {
+		return a.cfg.Key
+	}
+	return strings.SplitN(a.cfg.KeyTemplate, "{{", 2)[0]
+}
+
+// listVersions invokes fn with each version of the archive key, newest first,
+// until fn returns false or all versions have been listed; unless all is set,
+// listing stops at the most recent delete marker, as older versions were
+// deleted from the archive
+func (a *S3) listVersions(ctx context.Context, all bool, fn func(types.ObjectVersion) bool) error {
+	if a.keyTmpl != nil {
+		return a.listObjects(ctx, fn)
+	}
+
+	params := &s3.ListObjectVersionsInput{
+		Bucket:  &a.cfg.Bucket,
+		Prefix:  &a.cfg.Key,
+		MaxKeys: int32(a.pageSize()),
+	}
 	for {
-		// retrieve a batch of object versions
 		a.log("retrieving batch of archived versions...")
+		start := time.Now()
 		page, err := a.client.ListObjectVersions(ctx, params)
 		if err != nil {
-			return nil, fmt.Errorf("error listing object versions: %v", err)
+			return fmt.Errorf("error listing object versions: %v", err)
+		}
+		a.log("listed %d versions and %d delete markers under prefix %s in %s", len(page.Versions), len(page.DeleteMarkers), a.cfg.Key, time.Since(start))
+
+		// identify the most recent delete marker for the archive key, if any
+		var deleted *time.Time
+		if !all {
+			for _, m := range page.DeleteMarkers {
+				if *m.Key == a.cfg.Key && m.LastModified != nil && (deleted == nil || m.LastModified.After(*deleted)) {
+					deleted = m.LastModified
+				}
+			}
 		}
 
-		var lastKey, lastVersionID string
 		for _, item := range page.Versions {
-			lastKey, lastVersionID = *item.Key, *item.VersionId
-
-			// ignore keys that don't match
 			if *item.Key != a.cfg.Key {
 				continue
 			}
-
-			body, err := a.downloadObjectVersion(ctx, &item)
-			if err != nil {
-				return nil, err
+			// the latest version always follows any delete marker, which may
+			// share its last modified time at second precision
+			if deleted != nil && item.LastModified != nil && !item.IsLatest && !item.LastModified.After(*deleted) {
+				a.log("reached delete marker at %s", deleted.Format(time.RFC3339))
+				return nil
 			}
-
-			sumb := md5.Sum(body)
-			sum := hex.EncodeToString(sumb[:])
-			if _, ok := a.sums[sum]; ok {
-				a.log("ignoring version with previously seen sum: %s", sum)
-				continue
+			if !fn(item) {
+				return nil
 			}
+		}
 
-			a.log("adding archived version to history: %s", string(body))
-			versions, n = append(versions, body), n+1
-			a.sums[sum] = struct{}{}
+		if deleted != nil || !page.IsTruncated {
+			return nil
+		}
 
-			// return early if we've
-			if max := a.cfg.MaxVersions; max > 0 && n >= max {
-				a.log("truncating archive history: max version limit %d reached", max)
-				a.reverse(versions)
-				a.fetched = true
-				return versions, nil
-			}
+		// advance pagination markers, which are always returned for truncated
+		// responses
+		if page.NextKeyMarker == nil || *page.NextKeyMarker == "" {
+			return fmt.Errorf("error listing object versions: truncated response missing next key marker")
 		}
+		params.KeyMarker, params.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+	}
+}
+
+// pageSize returns the configured listing page size
+func (a *S3) pageSize() int {
+	if a.cfg.PageSize > 0 {
+		return a.cfg.PageSize
+	}
+	return defaultPageSize
+}
 
-		// return if last page
-		if !page.IsTruncated || len(page.Versions) == 0 {
-			a.log("reached end of archive history")
-			a.reverse(versions)
-			a.fetched = true
-			return versions, nil
+// listObjects invokes fn with each per-version object under the key template
+// prefix, newest first, until fn returns false or all objects have been listed
+func (a *S3) listObjects(ctx context.Context, fn func(types.ObjectVersion) bool) error {
+	prefix := a.prefix()
+	params := &s3.ListObjectsV2Input{
+		Bucket:  &a.cfg.Bucket,
+		Prefix:  &prefix,
+		MaxKeys: int32(a.pageSize()),
+	}
+
+	var objects []types.Object
+	for {
+		start := time.Now()
+		page, err := a.client.ListObjectsV2(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error listing objects: %v", err)
+		}
+		a.log("listed %d objects under prefix %s in %s", len(page.Contents), prefix, time.Since(start))
+		for _, obj := range page.Contents {
+			a.log("listed archived object: %s", *obj.Key)
 		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == nil {
+			break
+		}
+		params.ContinuationToken = page.NextContinuationToken
+	}
 
-		// otherwise, update pagination parameters before next iteration
-		params.KeyMarker, params.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
-		if *params.KeyMarker == "" {
-			params.KeyMarker, params.VersionIdMarker = &lastKey, &lastVersionID
+	// order objects modified within the same second, which is the precision
+	// of the last modified time, by key, such that keys beginning with the
+	// timestamp are ordered by the time of archival
+	sort.SliceStable(objects, func(i, j int) bool {
+		if !objects[i].LastModified.Equal(*objects[j].LastModified) {
+			return objects[i].LastModified.After(*objects[j].LastModified)
+		}
+		return *objects[i].Key > *objects[j].Key
+	})
+	for i, obj := range objects {
+		item := types.ObjectVersion{Key: obj.Key, LastModified: obj.LastModified, IsLatest: i == 0}
+		if !fn(item) {
+			return nil
 		}
 	}
+	return nil
+}
+
+// history retrieves up to max distinct versions from the archive history,
+// oldest first, where a max of zero retrieves the full history; unless raw is
+// set, versions are returned without their envelope
+func (a *S3) history(ctx context.Context, max int, raw bool) (versions [][]byte, err error) {
+	var n int
+	seen := make(map[string]struct{})
+	err = a.listVersions(ctx, false, func(item types.ObjectVersion) bool {
+		body, derr := a.downloadObjectVersion(ctx, &item)
+		if derr != nil {
+			err = derr
+			return false
+		}
+		version, derr := a.unseal(&item, body)
+		if derr != nil {
+			return true
+		}
+
+		sum := versionSum(version)
+		if _, ok := seen[sum]; ok {
+			a.log("ignoring version with previously seen sum: %s", sum)
+			return true
+		}
+
+		if a.quiet {
+			a.log("adding archived version to history: %s", sum)
+		} else {
+			a.log("adding archived version to history: %s", string(version))
+		}
+		if !raw {
+			body = version
+		}
+		versions, n = append(versions, body), n+1
+		seen[sum], a.sums[sum] = struct{}{}, struct{}{}
+
+		if max > 0 && n >= max {
+			a.log("truncating archive history: max version limit %d reached", max)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.reverse(versions)
+	a.fetched = true
+	return versions, nil
+}
+
+// unseal verifies and unwraps a downloaded object, warning about objects that
+// fail verification
+func (a *S3) unseal(item *types.ObjectVersion, body []byte) ([]byte, error) {
+	version, err := unseal(body)
+	if err != nil {
+		color.Yellow("skipping invalid archived object %s: %v", *item.Key, err)
+		return nil, err
+	}
+	return version, nil
 }
 
 func (a *S3) log(format string, args ...interface{}) {
@@ -217,6 +631,7 @@ func (a *S3) log(format string, args ...interface{}) {
 
 func (a *S3) downloadObjectVersion(ctx context.Context, v *types.ObjectVersion) ([]byte, error) {
 	// download object version
+	start := time.Now()
 	version, err := a.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket:    &a.cfg.Bucket,
 		Key:       v.Key,
@@ -232,6 +647,11 @@ func (a *S3) downloadObjectVersion(ctx context.Context, v *types.ObjectVersion)
 	if err != nil {
 		return nil, fmt.Errorf("error reading object version content: %v", err)
 	}
+	versionID := "latest"
+	if v.VersionId != nil {
+		versionID = *v.VersionId
+	}
+	a.log("downloaded %s (version %s, %d bytes) in %s", *v.Key, versionID, len(body), time.Since(start))
 	return body, nil
 }
 
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	sdkarchive "github.com/cludden/concourse-go-sdk/pkg/archive"
+)
+
+// Backend adapts an Archive to the version archive interface of the
+// concourse-go-sdk, such that it can back source.archive
+type Backend struct {
+	Archive Archive
+	// ForceHistory returns the archive history even when concourse provides
+	// the latest version, consistent with the sdk archive backends
+	ForceHistory bool
+	// Keep prunes all but the most recent Keep versions after each put, if
+	// greater than zero
+	Keep int
+	// LatestOnly hydrates checks with only the most recently archived
+	// version, rather than the full history
+	LatestOnly bool
+	// Raw reads and writes archived objects as stored, including any
+	// envelope, for migrations between archives
+	Raw bool
+}
+
+func (b *Backend) Close(ctx context.Context) error {
+	if c, ok := b.Archive.(interface{ Close(context.Context) error }); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+func (b *Backend) History(ctx context.Context, latest []byte) ([][]byte, error) {
+	if b.Raw {
+		return b.Archive.Export(ctx)
+	}
+	// exit early if concourse has version history
+	if latest != nil && !b.ForceHistory {
+		return nil, nil
+	}
+	if !b.LatestOnly {
+		return b.Archive.History(ctx)
+	}
+	v, err := b.Archive.Latest(ctx)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return [][]byte{v}, nil
+}
+
+func (b *Backend) Put(ctx context.Context, versions ...[]byte) error {
+	if b.Raw {
+		return b.Archive.Import(ctx, versions...)
+	}
+	for _, v := range versions {
+		if err := b.Archive.Put(ctx, json.RawMessage(v)); err != nil {
+			return err
+		}
+	}
+	if b.Keep > 0 {
+		return b.Archive.Prune(ctx, b.Keep)
+	}
+	return nil
+}
+
+// SDK adapts one of the boltdb or inmem archive backends of the
+// concourse-go-sdk to the Archive interface, such that retention is applied
+// uniformly across backends; as the sdk backends only append versions, the
+// latest version is the last element of the history, and versions cannot be
+// pruned
+type SDK struct {
+	Archive sdkarchive.Archive
+}
+
+func (a *SDK) Close(ctx context.Context) error {
+	return a.Archive.Close(ctx)
+}
+
+func (a *SDK) History(ctx context.Context) ([][]byte, error) {
+	return a.Archive.History(ctx, nil)
+}
+
+func (a *SDK) Latest(ctx context.Context) ([]byte, error) {
+	history, err := a.History(ctx)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return history[len(history)-1], nil
+}
+
+func (a *SDK) Prune(context.Context, int) error {
+	return fmt.Errorf("pruning is not supported by the boltdb and inmem archive backends")
+}
+
+func (a *SDK) Put(ctx context.Context, v interface{}) error {
+	b, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("error serializing version: %v", err)
+		}
+	}
+	return a.Archive.Put(ctx, b)
+}
+
+func (a *SDK) Export(ctx context.Context) ([][]byte, error) {
+	return a.History(ctx)
+}
+
+func (a *SDK) Import(ctx context.Context, objects ...[]byte) error {
+	return a.Archive.Put(ctx, objects...)
+}
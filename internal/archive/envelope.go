@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/concourse-steampipe-resource/internal/build"
+)
+
+// schemaVersion defines the current archive envelope schema version
+const schemaVersion = 2
+
+type (
+	// envelope wraps an archived version with the metadata required to verify
+	// its integrity and audit its origin
+	envelope struct {
+		Schema     int             `json:"schema"`
+		Checksum   string          `json:"checksum"`
+		Timestamp  string          `json:"timestamp,omitempty"`
+		ConfigHash string          `json:"config_hash,omitempty"`
+		Provenance *Provenance     `json:"provenance,omitempty"`
+		Version    json.RawMessage `json:"version"`
+	}
+
+	// Provenance describes the concourse build that archived a version
+	Provenance struct {
+		Team     string `json:"team,omitempty"`
+		Pipeline string `json:"pipeline,omitempty"`
+		Job      string `json:"job,omitempty"`
+		Build    string `json:"build,omitempty"`
+		URL      string `json:"url,omitempty"`
+	}
+)
+
+// provenance returns the provenance of the current build from the concourse
+// build metadata environment, which is only fully available during put
+func provenance() *Provenance {
+	meta := build.Metadata()
+	if meta == nil {
+		return nil
+	}
+	return &Provenance{
+		Team:     meta["team"],
+		Pipeline: meta["pipeline"],
+		Job:      meta["job"],
+		Build:    meta["build"],
+		URL:      build.URL(meta),
+	}
+}
+
+// seal wraps the serialized version in an envelope along with the time of
+// archival, build provenance, and the given resource config hash
+func seal(version []byte, configHash string) ([]byte, error) {
+	b, err := json.Marshal(envelope{
+		Schema:     schemaVersion,
+		Checksum:   checksum(version),
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		ConfigHash: configHash,
+		Provenance: provenance(),
+		Version:    version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing archive envelope: %v", err)
+	}
+	return b, nil
+}
+
+// unseal verifies and unwraps an archived object, returning the serialized
+// version; legacy objects containing a bare version are returned as is, while
+// corrupted or foreign objects return an error
+func unseal(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("object is not a json object: %v", err)
+	}
+
+	// treat objects without envelope fields as legacy bare versions
+	_, hasSchema := fields["schema"]
+	_, hasChecksum := fields["checksum"]
+	_, hasVersion := fields["version"]
+	if !hasSchema || !hasChecksum || !hasVersion {
+		return body, nil
+	}
+
+	var e envelope
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("invalid envelope: %v", err)
+	}
+	if e.Schema < 1 || e.Schema > schemaVersion {
+		return nil, fmt.Errorf("unsupported envelope schema version: %d", e.Schema)
+	}
+	if sum := checksum(e.Version); sum != e.Checksum {
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", e.Checksum, sum)
+	}
+	return e.Version, nil
+}
+
+// checksum computes the checksum of the compacted serialized version
+func checksum(version []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, version); err == nil {
+		version = buf.Bytes()
+	}
+	sum := sha256.Sum256(version)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
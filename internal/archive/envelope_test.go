@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSealUnseal(t *testing.T) {
+	version := []byte(`{"count":"3"}`)
+	sealed, err := seal(version, "abc123")
+	if err != nil {
+		t.Fatalf("error sealing version: %v", err)
+	}
+
+	var e envelope
+	if err := json.Unmarshal(sealed, &e); err != nil {
+		t.Fatalf("error parsing envelope: %v", err)
+	}
+	if e.Schema != schemaVersion || e.ConfigHash != "abc123" || e.Checksum != checksum(version) {
+		t.Fatalf("unexpected envelope: %s", sealed)
+	}
+
+	got, err := unseal(sealed)
+	if err != nil {
+		t.Fatalf("error unsealing version: %v", err)
+	}
+	if string(got) != string(version) {
+		t.Fatalf("expected %s, got %s", version, got)
+	}
+}
+
+func TestUnseal(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want string
+		err  string
+	}{
+		{
+			name: "legacy",
+			body: `{"count":"3"}`,
+			want: `{"count":"3"}`,
+		},
+		{
+			name: "checksum is computed over compacted version",
+			body: `{"schema":2,"checksum":"` + checksum([]byte(`{"count":"3"}`)) + `","version":{ "count": "3" }}`,
+			want: `{ "count": "3" }`,
+		},
+		{
+			name: "checksum mismatch",
+			body: `{"schema":2,"checksum":"` + checksum([]byte(`{"count":"3"}`)) + `","version":{"count":"4"}}`,
+			err:  "checksum mismatch",
+		},
+		{
+			name: "unsupported schema",
+			body: `{"schema":3,"checksum":"` + checksum([]byte(`{"count":"3"}`)) + `","version":{"count":"3"}}`,
+			err:  "unsupported envelope schema version: 3",
+		},
+		{
+			name: "foreign object",
+			body: `not json`,
+			err:  "object is not a json object",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := unseal([]byte(c.body))
+			switch {
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing '%s', got %v", c.err, err)
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case string(got) != c.want:
+				t.Fatalf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
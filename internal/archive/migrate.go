@@ -0,0 +1,30 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+)
+
+// Store describes an archive that reads and writes archived objects as
+// stored, e.g. the sdk archive backends or a raw Backend
+type Store interface {
+	History(ctx context.Context, latest []byte) ([][]byte, error)
+	Put(ctx context.Context, objects ...[]byte) error
+}
+
+// Migrate copies the stored objects of src to dst as is, oldest first, so
+// that order is preserved and each object retains its checksum, timestamp,
+// and provenance, returning the number of objects copied; objects already
+// present in dst are skipped by its deduplication
+func Migrate(ctx context.Context, src, dst Store) (int, error) {
+	history, err := src.History(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving source archive history: %v", err)
+	}
+	for i, obj := range history {
+		if err := dst.Put(ctx, obj); err != nil {
+			return i, fmt.Errorf("error archiving version %d of %d: %v", i+1, len(history), err)
+		}
+	}
+	return len(history), nil
+}
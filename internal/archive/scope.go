@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Scope describes how archive keys are scoped across pipeline instances
+type Scope struct {
+	// InstanceVars scopes archive keys to the pipeline instance, identified by
+	// Vars if specified, otherwise by the instance vars in the build
+	// environment, which are only available during get and put
+	InstanceVars bool                   `json:"instance_vars"`
+	Vars         map[string]interface{} `json:"vars"`
+}
+
+// segment returns the key segment that identifies the scope, or an empty
+// string if keys are shared across instances
+func (s *Scope) segment() (string, error) {
+	if s == nil || !s.InstanceVars {
+		return "", nil
+	}
+
+	var vars interface{} = s.Vars
+	if len(s.Vars) == 0 {
+		raw := os.Getenv("BUILD_PIPELINE_INSTANCE_VARS")
+		if raw == "" {
+			return "", fmt.Errorf("archive scope requires instance vars, which must be specified via scope.vars when unavailable in the build environment (e.g. during check)")
+		}
+		if err := json.Unmarshal([]byte(raw), &vars); err != nil {
+			return "", fmt.Errorf("error parsing instance vars: %v", err)
+		}
+	}
+
+	// encoding/json sorts map keys, providing a canonical serialization
+	b, err := json.Marshal(vars)
+	if err != nil {
+		return "", fmt.Errorf("error serializing instance vars: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return "instance-" + hex.EncodeToString(sum[:])[:12], nil
+}
+
+// scopeKey inserts the scope segment prior to the final element of the key
+func scopeKey(key, segment string) string {
+	if segment == "" || key == "" {
+		return key
+	}
+	dir, base := path.Split(key)
+	return dir + segment + "/" + base
+}
+
+// Namespace describes automatic prefixing of archive keys with the concourse
+// team, pipeline, and resource names, allowing a single bucket to host the
+// archives of many resources
+type Namespace struct {
+	Enabled bool `json:"enabled"`
+	// Resource identifies the resource within the pipeline, which is
+	// unavailable in the build environment
+	Resource string `json:"resource"`
+	// Team and Pipeline override the names in the build environment, which are
+	// only available during get and put
+	Team     string `json:"team"`
+	Pipeline string `json:"pipeline"`
+}
+
+// prefix returns the namespace key prefix, or an empty string if disabled
+func (n *Namespace) prefix() (string, error) {
+	if n == nil || !n.Enabled {
+		return "", nil
+	}
+	if n.Resource == "" {
+		return "", fmt.Errorf("archive namespace requires the resource name, which must be specified via namespace.resource")
+	}
+	team, pipeline := n.Team, n.Pipeline
+	if team == "" {
+		team = os.Getenv("BUILD_TEAM_NAME")
+	}
+	if pipeline == "" {
+		pipeline = os.Getenv("BUILD_PIPELINE_NAME")
+	}
+	if team == "" || pipeline == "" {
+		return "", fmt.Errorf("archive namespace requires team and pipeline names, which must be specified via namespace.team and namespace.pipeline when unavailable in the build environment (e.g. during check)")
+	}
+	return path.Join(team, pipeline, n.Resource) + "/", nil
+}
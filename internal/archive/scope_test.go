@@ -0,0 +1,148 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopeSegment(t *testing.T) {
+	cases := []struct {
+		name  string
+		scope *Scope
+		env   string
+		want  string
+		err   string
+	}{
+		{
+			name: "unscoped",
+		},
+		{
+			name:  "disabled",
+			scope: &Scope{Vars: map[string]interface{}{"env": "prod"}},
+		},
+		{
+			name:  "vars",
+			scope: &Scope{InstanceVars: true, Vars: map[string]interface{}{"env": "prod", "region": "us-west-2"}},
+			want:  "instance-01703301962f",
+		},
+		{
+			name:  "build environment vars are canonicalized",
+			scope: &Scope{InstanceVars: true},
+			env:   `{"region": "us-west-2", "env": "prod"}`,
+			want:  "instance-01703301962f",
+		},
+		{
+			name:  "missing vars",
+			scope: &Scope{InstanceVars: true},
+			err:   "archive scope requires instance vars",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("BUILD_PIPELINE_INSTANCE_VARS", c.env)
+			got, err := c.scope.segment()
+			switch {
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing '%s', got %v", c.err, err)
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case got != c.want:
+				t.Fatalf("expected '%s', got '%s'", c.want, got)
+			}
+		})
+	}
+}
+
+func TestScopeKey(t *testing.T) {
+	cases := []struct {
+		key, segment, want string
+	}{
+		{"drift.json", "", "drift.json"},
+		{"drift.json", "instance-abc", "instance-abc/drift.json"},
+		{"archives/drift.json", "instance-abc", "archives/instance-abc/drift.json"},
+		{"drift/{{ .timestamp }}.json", "instance-abc", "drift/instance-abc/{{ .timestamp }}.json"},
+		{"", "instance-abc", ""},
+	}
+	for _, c := range cases {
+		if got := scopeKey(c.key, c.segment); got != c.want {
+			t.Errorf("scopeKey(%q, %q): expected '%s', got '%s'", c.key, c.segment, c.want, got)
+		}
+	}
+}
+
+func TestNamespacePrefix(t *testing.T) {
+	cases := []struct {
+		name      string
+		namespace *Namespace
+		team      string
+		pipeline  string
+		want      string
+		err       string
+	}{
+		{
+			name: "disabled",
+			team: "main",
+		},
+		{
+			name:      "build environment",
+			namespace: &Namespace{Enabled: true, Resource: "public-buckets"},
+			team:      "main",
+			pipeline:  "drift",
+			want:      "main/drift/public-buckets/",
+		},
+		{
+			name:      "overrides",
+			namespace: &Namespace{Enabled: true, Resource: "public-buckets", Team: "platform", Pipeline: "audit"},
+			team:      "main",
+			pipeline:  "drift",
+			want:      "platform/audit/public-buckets/",
+		},
+		{
+			name:      "missing pipeline",
+			namespace: &Namespace{Enabled: true, Resource: "public-buckets"},
+			team:      "main",
+			err:       "archive namespace requires team and pipeline names",
+		},
+		{
+			name:      "missing resource",
+			namespace: &Namespace{Enabled: true},
+			team:      "main",
+			pipeline:  "drift",
+			err:       "archive namespace requires the resource name",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("BUILD_TEAM_NAME", c.team)
+			t.Setenv("BUILD_PIPELINE_NAME", c.pipeline)
+			got, err := c.namespace.prefix()
+			switch {
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing '%s', got %v", c.err, err)
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case got != c.want:
+				t.Fatalf("expected '%s', got '%s'", c.want, got)
+			}
+		})
+	}
+}
+
+func TestNamespacePrefixResources(t *testing.T) {
+	t.Setenv("BUILD_TEAM_NAME", "main")
+	t.Setenv("BUILD_PIPELINE_NAME", "drift")
+
+	buckets, err := (&Namespace{Enabled: true, Resource: "public-buckets"}).prefix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := (&Namespace{Enabled: true, Resource: "open-security-groups"}).prefix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buckets == groups {
+		t.Fatalf("expected resources of the same pipeline to have distinct prefixes, got '%s'", buckets)
+	}
+}
@@ -0,0 +1,167 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/fatih/color"
+)
+
+type (
+	// Config describes an S3 object store
+	Config struct {
+		Bucket      string       `json:"bucket" validate:"required"`
+		Prefix      string       `json:"prefix"`
+		Region      string       `json:"region" validate:"required"`
+		Endpoint    string       `json:"endpoint"`
+		Credentials *Credentials `json:"credentials,omitempty" validate:"omitempty,dive"`
+	}
+
+	// Credentials describes static AWS credentials
+	Credentials struct {
+		AccessKey    string `json:"access_key" validate:"required_with=SecretKey"`
+		SecretKey    string `json:"secret_key" validate:"required_with=AccessKey"`
+		SessionToken string `json:"session_token"`
+	}
+
+	// Object describes a stored object
+	Object struct {
+		Body         []byte
+		LastModified time.Time
+	}
+
+	// Store implements a simple key/value store backed by S3 objects
+	Store struct {
+		cfg    *Config
+		client *s3.Client
+		debug  bool
+	}
+)
+
+func New(ctx context.Context, cfg *Config, debug bool) (*Store, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithDefaultRegion(cfg.Region),
+	}
+	if creds := cfg.Credentials; creds != nil {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(creds.AccessKey, creds.SecretKey, creds.SessionToken)))
+	}
+
+	sess, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading aws config: %v", err)
+	}
+
+	var s3opts []func(*s3.Options)
+	if cfg.Endpoint != "" {
+		s3opts = append(s3opts,
+			s3.WithEndpointResolver(s3.EndpointResolverFromURL(cfg.Endpoint)),
+			func(o *s3.Options) {
+				o.UsePathStyle = true
+			},
+		)
+	}
+
+	return &Store{
+		cfg:    cfg,
+		client: s3.NewFromConfig(sess, s3opts...),
+		debug:  debug,
+	}, nil
+}
+
+// Get retrieves the object with the given key, returning nil if not found
+func (s *Store) Get(ctx context.Context, key string) (*Object, error) {
+	k := s.key(key)
+	obj, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    &k,
+	})
+	if err != nil {
+		var notFound *types.NoSuchKey
+		if errors.As(err, &notFound) {
+			s.log("object not found: %s", k)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error downloading object '%s': %v", k, err)
+	}
+	defer obj.Body.Close()
+
+	body, err := ioutil.ReadAll(obj.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading object '%s': %v", k, err)
+	}
+	s.log("downloaded object: %s (%d bytes)", k, len(body))
+
+	result := &Object{Body: body}
+	if obj.LastModified != nil {
+		result.LastModified = *obj.LastModified
+	}
+	return result, nil
+}
+
+// Open streams the object with the given key and optional version id
+func (s *Store) Open(ctx context.Context, key, version string) (io.ReadCloser, error) {
+	k := s.key(key)
+	input := &s3.GetObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    &k,
+	}
+	if version != "" {
+		input.VersionId = &version
+	}
+	obj, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading object '%s': %v", k, err)
+	}
+	s.log("opened object: %s", k)
+	return obj.Body, nil
+}
+
+// Put writes an object with the given key
+func (s *Store) Put(ctx context.Context, key string, value []byte) error {
+	k := s.key(key)
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    &k,
+		Body:   bytes.NewReader(value),
+	})
+	if err != nil {
+		return fmt.Errorf("error uploading object '%s': %v", k, err)
+	}
+	s.log("uploaded object: %s (%d bytes)", k, len(value))
+	return nil
+}
+
+// Delete removes the object with the given key
+func (s *Store) Delete(ctx context.Context, key string) error {
+	k := s.key(key)
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    &k,
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting object '%s': %v", k, err)
+	}
+	s.log("deleted object: %s", k)
+	return nil
+}
+
+// key returns the fully qualified object key
+func (s *Store) key(key string) string {
+	return path.Join(s.cfg.Prefix, key)
+}
+
+func (s *Store) log(format string, args ...interface{}) {
+	if s.debug {
+		color.Yellow(format, args...)
+	}
+}
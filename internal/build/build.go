@@ -0,0 +1,54 @@
+package build
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Metadata returns the concourse build metadata of the current operation,
+// which is only fully available to gets and puts
+func Metadata() map[string]string {
+	var meta map[string]string
+	for k, env := range map[string]string{
+		"build":         "BUILD_NAME",
+		"build_id":      "BUILD_ID",
+		"instance_vars": "BUILD_PIPELINE_INSTANCE_VARS",
+		"job":           "BUILD_JOB_NAME",
+		"pipeline":      "BUILD_PIPELINE_NAME",
+		"team":          "BUILD_TEAM_NAME",
+	} {
+		if v := os.Getenv(env); v != "" {
+			if meta == nil {
+				meta = make(map[string]string)
+			}
+			meta[k] = v
+		}
+	}
+	return meta
+}
+
+// URL returns the url of the build described by the given build metadata,
+// falling back to the build id or pipeline if the job build is unknown, or an
+// empty string if ATC_EXTERNAL_URL is not available
+func URL(meta map[string]string) string {
+	base := strings.TrimRight(os.Getenv("ATC_EXTERNAL_URL"), "/")
+	switch {
+	case base == "":
+		return ""
+	case meta["team"] != "" && meta["pipeline"] != "" && meta["job"] != "" && meta["build"] != "":
+		u := fmt.Sprintf("%s/teams/%s/pipelines/%s/jobs/%s/builds/%s", base,
+			url.PathEscape(meta["team"]), url.PathEscape(meta["pipeline"]), url.PathEscape(meta["job"]), url.PathEscape(meta["build"]))
+		if vars := meta["instance_vars"]; vars != "" {
+			u += "?vars=" + url.QueryEscape(vars)
+		}
+		return u
+	case meta["build_id"] != "":
+		return fmt.Sprintf("%s/builds/%s", base, url.PathEscape(meta["build_id"]))
+	case meta["team"] != "" && meta["pipeline"] != "":
+		return fmt.Sprintf("%s/teams/%s/pipelines/%s", base, url.PathEscape(meta["team"]), url.PathEscape(meta["pipeline"]))
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,60 @@
+package build
+
+import "testing"
+
+func TestURL(t *testing.T) {
+	cases := []struct {
+		name string
+		base string
+		meta map[string]string
+		want string
+	}{
+		{
+			name: "job build",
+			base: "https://ci.example.com/",
+			meta: map[string]string{"build": "42", "build_id": "1234", "job": "scan", "pipeline": "drift", "team": "main"},
+			want: "https://ci.example.com/teams/main/pipelines/drift/jobs/scan/builds/42",
+		},
+		{
+			name: "instanced pipeline",
+			base: "https://ci.example.com",
+			meta: map[string]string{"build": "42", "instance_vars": `{"env":"prod"}`, "job": "scan", "pipeline": "drift", "team": "main"},
+			want: "https://ci.example.com/teams/main/pipelines/drift/jobs/scan/builds/42?vars=%7B%22env%22%3A%22prod%22%7D",
+		},
+		{
+			name: "escaped segments",
+			base: "https://ci.example.com",
+			meta: map[string]string{"build": "42.1", "job": "scan/all", "pipeline": "drift", "team": "main"},
+			want: "https://ci.example.com/teams/main/pipelines/drift/jobs/scan%2Fall/builds/42.1",
+		},
+		{
+			name: "build id",
+			base: "https://ci.example.com",
+			meta: map[string]string{"build_id": "1234", "pipeline": "drift", "team": "main"},
+			want: "https://ci.example.com/builds/1234",
+		},
+		{
+			name: "pipeline",
+			base: "https://ci.example.com",
+			meta: map[string]string{"pipeline": "drift", "team": "main"},
+			want: "https://ci.example.com/teams/main/pipelines/drift",
+		},
+		{
+			name: "missing external url",
+			meta: map[string]string{"build_id": "1234"},
+		},
+		{
+			name: "missing metadata",
+			base: "https://ci.example.com",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("ATC_EXTERNAL_URL", c.base)
+			if got := URL(c.meta); got != c.want {
+				t.Fatalf("expected '%s', got '%s'", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+type Config struct {
+	TTL   string       `json:"ttl" validate:"required"`
+	Debug bool         `json:"debug"`
+	S3    *blob.Config `json:"s3" validate:"required"`
+}
+
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Put(ctx context.Context, key string, value []byte) error
+}
+
+func New(ctx context.Context, cfg *Config) (Cache, error) {
+	ttl, err := time.ParseDuration(cfg.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ttl: %v", err)
+	}
+	return NewS3(ctx, cfg.S3, ttl, cfg.Debug)
+}
+
+// Key computes a cache key from the given parts
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// =============================================================================
+
+// S3 implements a cache backed by S3 objects, where entries expire based on
+// object modification time
+type S3 struct {
+	store *blob.Store
+	debug bool
+	ttl   time.Duration
+}
+
+func NewS3(ctx context.Context, cfg *blob.Config, ttl time.Duration, debug bool) (*S3, error) {
+	store, err := blob.New(ctx, cfg, debug)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{store: store, debug: debug, ttl: ttl}, nil
+}
+
+// Get returns the cached value for the given key if present and not expired
+func (c *S3) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	obj, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil, false, fmt.Errorf("error retrieving cached result: %v", err)
+	}
+	if obj == nil {
+		c.log("cache miss: %s", key)
+		return nil, false, nil
+	}
+	if time.Since(obj.LastModified) > c.ttl {
+		c.log("cache expired: %s", key)
+		return nil, false, nil
+	}
+	c.log("cache hit: %s", key)
+	return obj.Body, true, nil
+}
+
+// Put caches the given value
+func (c *S3) Put(ctx context.Context, key string, value []byte) error {
+	if err := c.store.Put(ctx, key, value); err != nil {
+		return fmt.Errorf("error caching result: %v", err)
+	}
+	return nil
+}
+
+func (c *S3) log(format string, args ...interface{}) {
+	if c.debug {
+		color.Yellow(format, args...)
+	}
+}
@@ -0,0 +1,187 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/benthosdev/benthos/v4/public/bloblang"
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+// defaultMaxMessages defines the default maximum number of messages drained
+// per check
+const defaultMaxMessages = 100
+
+type (
+	// SQSConfig describes an SQS queue that receives change events (e.g.
+	// CloudTrail events delivered via EventBridge)
+	SQSConfig struct {
+		QueueURL          string            `json:"queue_url" validate:"required,url"`
+		Region            string            `json:"region" validate:"required"`
+		Endpoint          string            `json:"endpoint"`
+		Credentials       *blob.Credentials `json:"credentials,omitempty" validate:"omitempty,dive"`
+		Filter            string            `json:"filter"`
+		MaxMessages       int               `json:"max_messages" validate:"gte=0"`
+		VisibilityTimeout int               `json:"visibility_timeout" validate:"gte=0,lte=43200"`
+	}
+
+	// SQS implements a trigger backed by an SQS queue, which is pending when
+	// any messages matching the configured filter were received; matching
+	// messages are deleted once acknowledged, while all other messages are
+	// deleted immediately
+	SQS struct {
+		cfg     *SQSConfig
+		client  *sqs.Client
+		debug   bool
+		filter  *bloblang.Executor
+		matched []types.Message
+	}
+)
+
+func NewSQS(ctx context.Context, cfg *SQSConfig, debug bool) (*SQS, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithDefaultRegion(cfg.Region),
+	}
+	if creds := cfg.Credentials; creds != nil {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(creds.AccessKey, creds.SecretKey, creds.SessionToken)))
+	}
+
+	sess, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading aws config: %v", err)
+	}
+
+	var sqsopts []func(*sqs.Options)
+	if cfg.Endpoint != "" {
+		sqsopts = append(sqsopts, sqs.WithEndpointResolver(sqs.EndpointResolverFromURL(cfg.Endpoint)))
+	}
+
+	t := &SQS{
+		cfg:    cfg,
+		client: sqs.NewFromConfig(sess, sqsopts...),
+		debug:  debug,
+	}
+	if cfg.Filter != "" {
+		if t.filter, err = bloblang.Parse(cfg.Filter); err != nil {
+			return nil, fmt.Errorf("error parsing filter: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// Pending drains the queue, returning true if any matching messages were
+// received
+func (t *SQS) Pending(ctx context.Context) (bool, error) {
+	max := t.cfg.MaxMessages
+	if max <= 0 {
+		max = defaultMaxMessages
+	}
+
+	var received int
+	for received < max {
+		out, err := t.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            &t.cfg.QueueURL,
+			MaxNumberOfMessages: 10,
+			VisibilityTimeout:   int32(t.cfg.VisibilityTimeout),
+		})
+		if err != nil {
+			return false, fmt.Errorf("error receiving messages: %v", err)
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		received += len(out.Messages)
+
+		var ignored []types.Message
+		for _, m := range out.Messages {
+			match, err := t.match(m)
+			if err != nil {
+				return false, err
+			}
+			if match {
+				t.matched = append(t.matched, m)
+			} else {
+				ignored = append(ignored, m)
+			}
+		}
+		if err := t.delete(ctx, ignored); err != nil {
+			return false, err
+		}
+	}
+
+	t.log("received %d messages, %d matching", received, len(t.matched))
+	return len(t.matched) > 0, nil
+}
+
+// Ack deletes all matching messages received by Pending
+func (t *SQS) Ack(ctx context.Context) error {
+	if err := t.delete(ctx, t.matched); err != nil {
+		return err
+	}
+	t.matched = nil
+	return nil
+}
+
+// match evaluates the configured filter against the message body, which is
+// parsed as json if possible
+func (t *SQS) match(m types.Message) (bool, error) {
+	if t.filter == nil || m.Body == nil {
+		return true, nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal([]byte(*m.Body), &body); err != nil {
+		body = *m.Body
+	}
+	result, err := t.filter.Query(body)
+	if err != nil {
+		if err == bloblang.ErrRootDeleted {
+			return false, nil
+		}
+		return false, fmt.Errorf("error executing filter: %v", err)
+	}
+	match, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid filter result: expected bool, got %T", result)
+	}
+	return match, nil
+}
+
+// delete deletes the given messages in batches
+func (t *SQS) delete(ctx context.Context, messages []types.Message) error {
+	for len(messages) > 0 {
+		batch := messages
+		if len(batch) > 10 {
+			batch = batch[:10]
+		}
+		messages = messages[len(batch):]
+
+		entries := make([]types.DeleteMessageBatchRequestEntry, len(batch))
+		for i, m := range batch {
+			entries[i] = types.DeleteMessageBatchRequestEntry{Id: m.MessageId, ReceiptHandle: m.ReceiptHandle}
+		}
+		out, err := t.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: &t.cfg.QueueURL,
+			Entries:  entries,
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting messages: %v", err)
+		}
+		if len(out.Failed) > 0 {
+			return fmt.Errorf("error deleting messages: %d messages could not be deleted", len(out.Failed))
+		}
+	}
+	return nil
+}
+
+func (t *SQS) log(format string, args ...interface{}) {
+	if t.debug {
+		color.Yellow(format, args...)
+	}
+}
@@ -0,0 +1,205 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+type Config struct {
+	Type  string      `json:"type" validate:"required,oneof=http s3 sqs"`
+	Debug bool        `json:"debug"`
+	HTTP  *HTTPConfig `json:"http" validate:"required_if=Type http"`
+	S3    *S3Config   `json:"s3" validate:"required_if=Type s3"`
+	SQS   *SQSConfig  `json:"sqs" validate:"required_if=Type sqs"`
+}
+
+// Trigger describes an external signal that indicates whether a change may
+// have occurred since the last acknowledged check
+type Trigger interface {
+	// Pending returns true if a change was signalled since the last
+	// acknowledgement
+	Pending(ctx context.Context) (bool, error)
+	// Ack acknowledges all signals observed by Pending
+	Ack(ctx context.Context) error
+}
+
+func New(ctx context.Context, cfg *Config) (Trigger, error) {
+	switch cfg.Type {
+	case "http":
+		return NewHTTP(cfg.HTTP, cfg.Debug), nil
+	case "s3":
+		return NewS3(ctx, cfg.S3, cfg.Debug)
+	case "sqs":
+		return NewSQS(ctx, cfg.SQS, cfg.Debug)
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", cfg.Type)
+	}
+}
+
+// =============================================================================
+
+type (
+	// S3Config describes a dirty flag object, which is written by an external
+	// process (e.g. a webhook handler) whenever a change occurs
+	S3Config struct {
+		blob.Config
+		Key string `json:"key" validate:"required"`
+	}
+
+	// S3 implements a trigger backed by a dirty flag object, which is pending
+	// when the object was modified after the last acknowledged modification
+	S3 struct {
+		cfg      *S3Config
+		store    *blob.Store
+		debug    bool
+		observed time.Time
+	}
+)
+
+func NewS3(ctx context.Context, cfg *S3Config, debug bool) (*S3, error) {
+	store, err := blob.New(ctx, &cfg.Config, debug)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{cfg: cfg, store: store, debug: debug}, nil
+}
+
+// Pending returns true if the flag object was modified after the last
+// acknowledged modification
+func (t *S3) Pending(ctx context.Context) (bool, error) {
+	flag, err := t.store.Get(ctx, t.cfg.Key)
+	if err != nil {
+		return false, fmt.Errorf("error retrieving trigger flag: %v", err)
+	}
+	if flag == nil {
+		t.log("trigger flag not found: %s", t.cfg.Key)
+		return false, nil
+	}
+	t.observed = flag.LastModified
+
+	acked, err := t.store.Get(ctx, t.ackKey())
+	if err != nil {
+		return false, fmt.Errorf("error retrieving trigger acknowledgement: %v", err)
+	}
+	if acked == nil {
+		return true, nil
+	}
+	last, err := time.Parse(time.RFC3339Nano, string(acked.Body))
+	if err != nil {
+		t.log("ignoring invalid trigger acknowledgement: %v", err)
+		return true, nil
+	}
+	t.log("trigger flag modified at %s, last acknowledged %s", t.observed.Format(time.RFC3339), last.Format(time.RFC3339))
+	return t.observed.After(last), nil
+}
+
+// Ack records the modification time of the flag observed by Pending, so that
+// modifications made while the check was running remain pending
+func (t *S3) Ack(ctx context.Context) error {
+	if t.observed.IsZero() {
+		return nil
+	}
+	if err := t.store.Put(ctx, t.ackKey(), []byte(t.observed.Format(time.RFC3339Nano))); err != nil {
+		return fmt.Errorf("error acknowledging trigger: %v", err)
+	}
+	return nil
+}
+
+// ackKey returns the key of the acknowledgement object
+func (t *S3) ackKey() string {
+	return t.cfg.Key + ".ack"
+}
+
+func (t *S3) log(format string, args ...interface{}) {
+	if t.debug {
+		color.Yellow(format, args...)
+	}
+}
+
+// =============================================================================
+
+type (
+	// HTTPConfig describes an http endpoint that reports pending changes
+	HTTPConfig struct {
+		URL     string            `json:"url" validate:"required,url"`
+		AckURL  string            `json:"ack_url" validate:"omitempty,url"`
+		Headers map[string]string `json:"headers"`
+		Timeout string            `json:"timeout"`
+	}
+
+	// HTTP implements a trigger backed by an http endpoint, which responds
+	// with 200 when changes are pending and 204 or 304 otherwise, and is
+	// optionally notified via POST to a separate url once acknowledged
+	HTTP struct {
+		cfg    *HTTPConfig
+		client *http.Client
+		debug  bool
+	}
+)
+
+func NewHTTP(cfg *HTTPConfig, debug bool) *HTTP {
+	timeout := 30 * time.Second
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	return &HTTP{cfg: cfg, client: &http.Client{Timeout: timeout}, debug: debug}
+}
+
+// Pending requests the configured endpoint and interprets its status code
+func (t *HTTP) Pending(ctx context.Context) (bool, error) {
+	status, err := t.do(ctx, http.MethodGet, t.cfg.URL)
+	if err != nil {
+		return false, err
+	}
+	t.log("trigger endpoint responded with status %d", status)
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNoContent, http.StatusNotModified:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected trigger endpoint status: %d", status)
+	}
+}
+
+// Ack notifies the acknowledgement endpoint if configured
+func (t *HTTP) Ack(ctx context.Context) error {
+	if t.cfg.AckURL == "" {
+		return nil
+	}
+	status, err := t.do(ctx, http.MethodPost, t.cfg.AckURL)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("unexpected trigger acknowledgement status: %d", status)
+	}
+	return nil
+}
+
+func (t *HTTP) do(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error building trigger request: %v", err)
+	}
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting trigger endpoint: %v", err)
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func (t *HTTP) log(format string, args ...interface{}) {
+	if t.debug {
+		color.Yellow(format, args...)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+)
+
+// introspectionDir defines the output subdirectory that introspection files
+// are written to
+const introspectionDir = "introspection"
+
+// introspections defines the commands executed by an introspection put step,
+// keyed by output file name, where failures are recorded rather than
+// returned so that partial output remains available for troubleshooting
+var introspections = []struct {
+	file string
+	args []string
+}{
+	{"connection_state.json", []string{"query", "--output=json", "select * from steampipe_connection_state order by name"}},
+	{"plugins.txt", []string{"plugin", "list"}},
+	{"schemas.json", []string{"query", "--output=json", `select table_schema, table_name
+from information_schema.tables
+where table_schema not in ('pg_catalog', 'information_schema')
+order by table_schema, table_name`}},
+	{"service.txt", []string{"service", "status", "--all"}},
+}
+
+// introspect dumps steampipe connection state, plugin health, and schema
+// listings to the output directory in place of executing a query, emitting a
+// version that records the number of failed introspections
+func (r *Resource) introspect(ctx context.Context, s *Source, dir string) (Version, []sdk.Metadata, error) {
+	out := path.Join(dir, introspectionDir)
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return Version{}, nil, fmt.Errorf("error creating introspection directory: %v", err)
+	}
+
+	start := time.Now()
+	var failed int
+	for _, i := range introspections {
+		stdout, stderr, err := r.run(ctx, s, i.args...)
+		content := stdout
+		if err != nil {
+			failed++
+			color.Red("error introspecting %s: %v", i.file, err)
+			content = []byte(fmt.Sprintf("error: %v\n\nstdout:\n%s\nstderr:\n%s", err, string(stdout), string(stderr)))
+		}
+		f := path.Join(out, i.file)
+		if err := ioutil.WriteFile(f, content, artifactFileMode); err != nil {
+			return Version{}, nil, fmt.Errorf("error writing %s: %v", f, err)
+		}
+		if s.Debug {
+			color.Yellow("wrote introspection file: %s", f)
+		}
+	}
+
+	version := Version{map[string]interface{}{
+		"introspected_at": start.UTC().Format(time.RFC3339),
+		"failed":          fmt.Sprint(failed),
+	}}
+	return version, []sdk.Metadata{{Name: "failed", Value: fmt.Sprint(failed)}}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KubernetesCluster describes a kubernetes cluster for which a kubeconfig and
+// a matching steampipe kubernetes connection are written
+type KubernetesCluster struct {
+	Name                     string          `json:"name" validate:"required"`
+	Server                   string          `json:"server" validate:"required"`
+	CertificateAuthorityData string          `json:"certificate_authority_data"`
+	Exec                     *KubernetesExec `json:"exec" validate:"required_without=Token,excluded_with=Token"`
+	InsecureSkipTLSVerify    bool            `json:"insecure_skip_tls_verify"`
+	Namespace                string          `json:"namespace"`
+	Token                    string          `json:"token"`
+}
+
+// KubernetesExec describes an exec credential plugin used to authenticate
+// to a kubernetes cluster (e.g. aws eks get-token)
+type KubernetesExec struct {
+	APIVersion string            `json:"api_version"`
+	Args       []string          `json:"args"`
+	Command    string            `json:"command" validate:"required"`
+	Env        map[string]string `json:"env"`
+}
+
+// kubeDir returns the directory that kubeconfig files are written to
+func kubeDir(s *Source) string {
+	return path.Join(homeDir(s), ".kube")
+}
+
+// kubeconfigFile returns the path of the kubeconfig file for a cluster
+func kubeconfigFile(s *Source, c KubernetesCluster) string {
+	return path.Join(kubeDir(s), c.Name+".config")
+}
+
+// writeKubernetes writes a kubeconfig file per configured cluster, readable
+// only by the current user, along with the matching steampipe connections
+func writeKubernetes(s *Source) error {
+	if err := os.MkdirAll(kubeDir(s), 0700); err != nil {
+		return fmt.Errorf("error creating kubeconfig directory: %v", err)
+	}
+	for _, c := range s.Kubernetes {
+		b, err := json.MarshalIndent(renderKubeconfig(c), "", "  ")
+		if err != nil {
+			return fmt.Errorf("error serializing kubeconfig '%s': %v", c.Name, err)
+		}
+		f := kubeconfigFile(s, c)
+		if err := ioutil.WriteFile(f, b, 0600); err != nil {
+			return fmt.Errorf("error writing kubeconfig '%s': %v", c.Name, err)
+		}
+		// ensure permissions of a pre-existing file are restricted
+		if err := os.Chmod(f, 0600); err != nil {
+			return fmt.Errorf("error setting kubeconfig '%s' permissions: %v", c.Name, err)
+		}
+	}
+
+	conns := renderKubernetesConnections(s)
+	if err := ioutil.WriteFile(path.Join(configDir(s), "kubernetes.spc"), []byte(conns), 0600); err != nil {
+		return fmt.Errorf("error writing kubernetes connections: %v", err)
+	}
+	return nil
+}
+
+// renderKubeconfig renders a single-context kubeconfig for a cluster, which
+// is serialized as json, a subset of yaml accepted by kubernetes clients
+func renderKubeconfig(c KubernetesCluster) map[string]interface{} {
+	cluster := map[string]interface{}{
+		"server": c.Server,
+	}
+	if c.CertificateAuthorityData != "" {
+		cluster["certificate-authority-data"] = c.CertificateAuthorityData
+	}
+	if c.InsecureSkipTLSVerify {
+		cluster["insecure-skip-tls-verify"] = true
+	}
+
+	user := map[string]interface{}{}
+	if c.Token != "" {
+		user["token"] = c.Token
+	}
+	if c.Exec != nil {
+		apiVersion := c.Exec.APIVersion
+		if apiVersion == "" {
+			apiVersion = "client.authentication.k8s.io/v1beta1"
+		}
+		exec := map[string]interface{}{
+			"apiVersion": apiVersion,
+			"command":    c.Exec.Command,
+			"args":       c.Exec.Args,
+		}
+		if len(c.Exec.Env) > 0 {
+			names := make([]string, 0, len(c.Exec.Env))
+			for name := range c.Exec.Env {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			env := make([]map[string]string, len(names))
+			for i, name := range names {
+				env[i] = map[string]string{"name": name, "value": c.Exec.Env[name]}
+			}
+			exec["env"] = env
+		}
+		user["exec"] = exec
+	}
+
+	context := map[string]interface{}{
+		"cluster": c.Name,
+		"user":    c.Name,
+	}
+	if c.Namespace != "" {
+		context["namespace"] = c.Namespace
+	}
+
+	return map[string]interface{}{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"current-context": c.Name,
+		"clusters":        []interface{}{map[string]interface{}{"name": c.Name, "cluster": cluster}},
+		"contexts":        []interface{}{map[string]interface{}{"name": c.Name, "context": context}},
+		"users":           []interface{}{map[string]interface{}{"name": c.Name, "user": user}},
+	}
+}
+
+// renderKubernetesConnections renders a steampipe kubernetes connection per
+// configured cluster, named after the cluster
+func renderKubernetesConnections(s *Source) string {
+	var b strings.Builder
+	for _, c := range s.Kubernetes {
+		fmt.Fprintf(&b, "connection %s {\n", strconv.Quote(c.Name))
+		b.WriteString("  plugin         = \"kubernetes\"\n")
+		fmt.Fprintf(&b, "  config_path    = %s\n", strconv.Quote(kubeconfigFile(s, c)))
+		fmt.Fprintf(&b, "  config_context = %s\n", strconv.Quote(c.Name))
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// logLevels defines the rank of each supported log level
+var logLevels = map[string]int{
+	"error": 0,
+	"warn":  1,
+	"info":  2,
+	"debug": 3,
+	"trace": 4,
+}
+
+// logLevel returns the configured log level, where debug without an explicit
+// log level is equivalent to trace
+func logLevel(s *Source) string {
+	switch {
+	case s.LogLevel != "":
+		return s.LogLevel
+	case s.Debug:
+		return "trace"
+	default:
+		return ""
+	}
+}
+
+// logEnabled returns true if the configured log level includes the given
+// level
+func logEnabled(s *Source, level string) bool {
+	l := logLevel(s)
+	return l != "" && logLevels[l] >= logLevels[level]
+}
+
+// supported color modes
+const (
+	colorAlways = "always"
+	colorAuto   = "auto"
+	colorNever  = "never"
+)
+
+// noColor returns true if colored output should be disabled for the
+// configured color mode, where auto disables color when NO_COLOR is set or
+// the terminal is dumb
+func noColor(s *Source) bool {
+	switch s.Color {
+	case colorNever:
+		return true
+	case colorAuto:
+		return os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb"
+	default:
+		return false
+	}
+}
+
+// defaultEchoRows defines the default maximum number of rows echoed when
+// rendering results as a table
+const defaultEchoRows = 25
+
+// echo prints steampipe command output, truncated to the configured maximum
+// number of bytes, unless quiet mode is enabled
+func echo(s *Source, out []byte) {
+	if len(out) == 0 || s.Quiet {
+		return
+	}
+	if s.EchoFormat == "table" {
+		if table, ok := renderTable(out, s.EchoRows); ok {
+			out = table
+		}
+	}
+	if max := s.MaxLogBytes; max > 0 && len(out) > max {
+		color.Green("%s\n... (truncated %d bytes)", string(out[:max]), len(out)-max)
+		return
+	}
+	color.Green(string(out))
+}
+
+// redact returns the given data for inclusion in log and error messages,
+// unless quiet mode is enabled
+func redact(s *Source, data []byte) string {
+	if s.Quiet {
+		return "<redacted>"
+	}
+	return string(data)
+}
+
+// transcript records the stderr output of all steampipe commands executed
+// during a single get or put
+type transcript struct {
+	buf   bytes.Buffer
+	mu    sync.Mutex
+	start time.Time
+}
+
+// startTranscript begins recording steampipe stderr output
+func (r *Resource) startTranscript() {
+	r.transcript = &transcript{start: time.Now()}
+}
+
+// record appends the stderr output of a steampipe command to the transcript,
+// if recording
+func (r *Resource) record(args []string, stderr []byte, err error) {
+	t := r.transcript
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintf(&t.buf, "$ %s\n", strings.Join(args, " "))
+	t.buf.Write(stderr)
+	if err != nil {
+		fmt.Fprintf(&t.buf, "error: %v\n", err)
+	}
+	t.buf.WriteString("\n")
+}
+
+// writeTranscript writes the recorded transcript to the given file within the
+// step directory, followed by any steampipe log files written during the
+// operation when debug logging is enabled; failures are logged but otherwise
+// ignored so that they never mask the result of the operation
+func (r *Resource) writeTranscript(s *Source, dir, name string) {
+	t := r.transcript
+	if t == nil {
+		return
+	}
+	r.transcript = nil
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s.Debug {
+		logs, _ := filepath.Glob(path.Join(installDir(s), "logs", "*.log"))
+		sort.Strings(logs)
+		for _, f := range logs {
+			info, err := os.Stat(f)
+			if err != nil || info.ModTime().Before(t.start) {
+				continue
+			}
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&t.buf, "==> %s <==\n", f)
+			t.buf.Write(b)
+			t.buf.WriteString("\n")
+		}
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, name), t.buf.Bytes(), artifactFileMode); err != nil {
+		color.Red("error writing %s: %v", name, err)
+	}
+}
+
+// renderTable renders a json array of objects as an aligned table, capped at
+// the given number of rows, returning false if the output is not tabular
+func renderTable(out []byte, max int) ([]byte, bool) {
+	result := gjson.ParseBytes(out)
+	if !result.IsArray() {
+		return nil, false
+	}
+	rows := result.Array()
+	if len(rows) == 0 || !rows[0].IsObject() {
+		return nil, false
+	}
+	if max <= 0 {
+		max = defaultEchoRows
+	}
+
+	// use the column order of the first row
+	var columns []string
+	rows[0].ForEach(func(k, _ gjson.Result) bool {
+		columns = append(columns, k.String())
+		return true
+	})
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for i, row := range rows {
+		if i >= max {
+			break
+		}
+		fields, cells := row.Map(), make([]string, len(columns))
+		for j, c := range columns {
+			v := fields[c]
+			cell := v.Raw
+			if v.Type == gjson.String {
+				cell = v.String()
+			}
+			cells[j] = strings.NewReplacer("\n", " ", "\t", " ").Replace(cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	if len(rows) > max {
+		fmt.Fprintf(&buf, "... (%d more rows)\n", len(rows)-max)
+	}
+	return buf.Bytes(), true
+}
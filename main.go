@@ -1,32 +1,78 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path"
-	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/benthosdev/benthos/v4/public/bloblang"
 	sdk "github.com/cludden/concourse-go-sdk"
-	"github.com/cludden/concourse-go-sdk/pkg/archive"
 	"github.com/fatih/color"
 	"github.com/go-playground/validator/v10"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/cache"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/trigger"
 	"github.com/tidwall/gjson"
 )
 
 func main() {
-	sdk.Main[Source, Version, GetParams, PutParams](&Resource{})
+	// emit the json schema of the resource config in place of an operation,
+	// e.g. `check schema source`
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		var name string
+		if len(os.Args) > 2 {
+			name = os.Args[2]
+		}
+		if err := writeConfigSchema(os.Stdout, name); err != nil {
+			color.New(color.FgRed).Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var op sdk.Op
+	switch strings.TrimSpace(strings.ToLower(sdk.Operation)) {
+	case "check":
+		op = sdk.CheckOp
+	case "in":
+		op = sdk.InOp
+	case "out":
+		op = sdk.OutOp
+	}
+
+	// cancel the operation on SIGTERM, which is sent by concourse when a build
+	// is aborted, in addition to the signals handled by sdk.Main
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	r, start := &Resource{}, time.Now()
+	err := sdk.Exec[Source, Version, GetParams, PutParams](ctx, op, r, os.Stdin, os.Stdout, os.Stderr, os.Args)
+	if aerr := r.writeAudit(op, start, err); aerr != nil {
+		color.New(color.FgRed).Fprintln(os.Stderr, aerr)
+		if err == nil {
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		color.New(color.FgRed).Fprintln(os.Stderr, err)
+		r.reportFailure(os.Stderr)
+		os.Exit(1)
+	}
 }
 
 // =============================================================================
 
 const (
-	configdir = "/home/steampipe/.steampipe/config"
+	defaultHome       = "/home/steampipe"
+	defaultInstallDir = "/home/steampipe/.steampipe"
 )
 
 // =============================================================================
@@ -34,12 +80,145 @@ const (
 type (
 	// Source describes resource configuration
 	Source struct {
-		Archive        *archive.Config   `json:"archive" validate:"omitempty,dive"`
-		Config         string            `json:"config" validate:"required"`
-		Files          map[string]string `json:"files"`
-		Debug          bool              `json:"debug"`
-		Query          string            `json:"query" validate:"required"`
-		VersionMapping string            `json:"version_mapping"`
+		Aggregate          *Aggregate             `json:"aggregate" validate:"omitempty"`
+		AllowAbsolutePaths bool                   `json:"allow_absolute_paths"`
+		Archive            *ArchiveConfig         `json:"archive" validate:"omitempty"`
+		Audit              *blob.Config           `json:"audit" validate:"omitempty"`
+		AWSProfiles        map[string]AWSProfile  `json:"aws_profiles" validate:"omitempty,dive"`
+		Azure              *Azure                 `json:"azure" validate:"omitempty"`
+		Benchmark          *Benchmark             `json:"benchmark" validate:"omitempty,excluded_with=Pipeline Queries Query Shards"`
+		BuildLinks         bool                   `json:"build_links"`
+		Cache              *cache.Config          `json:"cache" validate:"omitempty"`
+		Color              string                 `json:"color" validate:"omitempty,oneof=auto always never"`
+		Columns            map[string]string      `json:"columns" validate:"omitempty,dive,oneof=string int float bool time"`
+		Config             string                 `json:"config" validate:"required"`
+		Diff               *DiffConfig            `json:"diff" validate:"omitempty"`
+		DigestField        string                 `json:"digest_field"`
+		DigestSource       string                 `json:"digest_source" validate:"omitempty,oneof=version results"`
+		EchoFormat         string                 `json:"echo_format" validate:"omitempty,oneof=json table"`
+		EchoRows           int                    `json:"echo_rows" validate:"gte=0"`
+		EmitResolution     bool                   `json:"emit_resolution"`
+		FileMode           string                 `json:"file_mode"`
+		FileOptions        map[string]FileOptions `json:"file_options" validate:"omitempty,dive"`
+		Files              map[string]string      `json:"files"`
+		Debug              bool                   `json:"debug"`
+		GCP                *GCP                   `json:"gcp" validate:"omitempty"`
+		Home               string                 `json:"home"`
+		Kubernetes         []KubernetesCluster    `json:"kubernetes" validate:"omitempty,dive"`
+		LogLevel           string                 `json:"log_level" validate:"omitempty,oneof=error warn info debug trace"`
+		Mapping            *Mapping               `json:"mapping" validate:"omitempty"`
+		MaxFileBytes       int                    `json:"max_file_bytes" validate:"gte=0"`
+		MaxLogBytes        int                    `json:"max_log_bytes" validate:"gte=0"`
+		MaxVersionSize     int                    `json:"max_version_size" validate:"gte=0"`
+		ModLocation        string                 `json:"mod_location"`
+		NormalizeStrings   *StringNormalization   `json:"normalize_strings" validate:"omitempty"`
+		NullPolicy         string                 `json:"null_policy" validate:"omitempty,oneof=omit empty null error"`
+		OIDC               *OIDC                  `json:"oidc" validate:"omitempty"`
+		OversizeStrategy   string                 `json:"oversize_strategy" validate:"omitempty,oneof=fail hash"`
+		Parallelism        int                    `json:"parallelism" validate:"gte=0"`
+		Pipeline           []PipelineStage        `json:"pipeline" validate:"omitempty,dive"`
+		PluginBundles      []PluginBundle         `json:"plugin_bundles" validate:"omitempty,dive"`
+		PluginRegistry     *PluginRegistry        `json:"plugin_registry"`
+		Plugins            []string               `json:"plugins"`
+		Preset             string                 `json:"preset"`
+		Queries            map[string]string      `json:"queries" validate:"omitempty,excluded_with=Pipeline"`
+		Query              string                 `json:"query" validate:"required_without_all=Benchmark Pipeline Queries"`
+		QueryTemplate      bool                   `json:"query_template"`
+		Quiet              bool                   `json:"quiet"`
+		RateLimits         []RateLimit            `json:"rate_limits" validate:"omitempty,dive"`
+		ResultSchema       map[string]interface{} `json:"result_schema"`
+		Retry              *Retry                 `json:"retry" validate:"omitempty"`
+		Sample             *Sample                `json:"sample" validate:"omitempty"`
+		ScanInterval       string                 `json:"scan_interval"`
+		Schema             string                 `json:"schema" validate:"omitempty,oneof=v1 v2"`
+		Select             map[string]string      `json:"select" validate:"omitempty,excluded_with=Mapping"`
+		Shards             *Shards                `json:"shards" validate:"omitempty,excluded_with=Pipeline Queries"`
+		Signing            *Signing               `json:"signing" validate:"omitempty"`
+		SkipErrors         []string               `json:"skip_errors" validate:"omitempty,dive,oneof=config plugin query service timeout unknown"`
+		Snapshots          *blob.Config           `json:"snapshots" validate:"required_with=Diff ScanInterval"`
+		Sort               []SortKey              `json:"sort" validate:"omitempty,dive"`
+		StateDir           string                 `json:"state_dir"`
+		SteampipeMirror    *SteampipeMirror       `json:"steampipe_mirror" validate:"omitempty"`
+		SteampipeVersion   string                 `json:"steampipe_version"`
+		Terraform          *Terraform             `json:"terraform" validate:"omitempty"`
+		Timestamps         *Timestamps            `json:"timestamps" validate:"omitempty"`
+		Trigger            *trigger.Config        `json:"trigger"`
+		Variables          map[string]interface{} `json:"variables"`
+		Vars               map[string]interface{} `json:"vars"`
+		VersionMapping     string                 `json:"version_mapping" validate:"omitempty,excluded_with=VersionMappingFile"`
+		VersionMappingFile string                 `json:"version_mapping_file"`
+		VersionSchema      map[string]interface{} `json:"version_schema"`
+		WarmupQueries      []string               `json:"warmup_queries"`
+		WorkDir            string                 `json:"work_dir"`
+		WritableDir        string                 `json:"writable_dir"`
+
+		// deprecations describes any deprecated fields migrated while
+		// parsing the source config
+		deprecations []string
+		// getQuery defines a default get query provided by a preset
+		getQuery string
+		// target is the shard that per-target versions are derived from
+		target string
+	}
+
+	// PluginBundle describes a pre-downloaded, gzipped plugin binary that is
+	// installed without registry access
+	PluginBundle struct {
+		Plugin  string `json:"plugin" validate:"required"`
+		Path    string `json:"path" validate:"required_without=Content"`
+		Content string `json:"content" validate:"excluded_with=Path"`
+	}
+
+	// PluginRegistry describes an OCI registry mirror used to install plugins
+	PluginRegistry struct {
+		URL      string `json:"url" validate:"required"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	// RateLimit describes a steampipe plugin rate limiter
+	RateLimit struct {
+		Name           string   `json:"name" validate:"required"`
+		Plugin         string   `json:"plugin" validate:"required"`
+		BucketSize     int      `json:"bucket_size" validate:"gte=0"`
+		Connection     string   `json:"connection"`
+		FillRate       float64  `json:"fill_rate" validate:"gte=0"`
+		MaxConcurrency int      `json:"max_concurrency" validate:"gte=0"`
+		Scope          []string `json:"scope"`
+		Where          string   `json:"where"`
+	}
+
+	// Benchmark describes steampipe benchmarks and controls to run
+	Benchmark struct {
+		Targets     []string          `json:"targets" validate:"required,min=1"`
+		MinSeverity string            `json:"min_severity" validate:"omitempty,oneof=none low medium high critical"`
+		Summarize   bool              `json:"summarize"`
+		Tags        map[string]string `json:"tags"`
+		Where       string            `json:"where"`
+
+		// exports defines files exported by a put step
+		exports []string
+	}
+
+	// DiffConfig describes row-level diff configuration
+	DiffConfig struct {
+		KeyFields     []string `json:"key_fields" validate:"required,min=1"`
+		CompareFields []string `json:"compare_fields"`
+	}
+
+	// Shards describes a fan-out of the configured query across connections
+	// or arbitrary shard values
+	Shards struct {
+		Connections []string `json:"connections" validate:"required_without=Values,excluded_with=Values"`
+		PerTarget   bool     `json:"per_target"`
+		Values      []string `json:"values" validate:"required_without=Connections"`
+	}
+
+	// PipelineStage describes a single query or mapping stage in a query pipeline
+	PipelineStage struct {
+		Name    string `json:"name"`
+		Query   string `json:"query" validate:"required_without=Mapping,excluded_with=Mapping"`
+		Mapping string `json:"mapping" validate:"required_without=Query"`
 	}
 
 	// Version describes versions managed by a resource
@@ -48,17 +227,153 @@ type (
 	}
 
 	// GetParams describes get step parameters
-	GetParams struct{}
+	GetParams struct {
+		Args           map[string]interface{} `json:"args"`
+		IncludeResults bool                   `json:"include_results"`
+		LogFile        string                 `json:"log_file"`
+		Output         *GetOutput             `json:"output"`
+		Query          string                 `json:"query"`
+		Snapshot       *GetSnapshot           `json:"snapshot"`
+		Verify         bool                   `json:"verify"`
+	}
+
+	// GetOutput describes the names of files written during get
+	GetOutput struct {
+		DiffFile    string `json:"diff_file"`
+		OmitVersion bool   `json:"omit_version"`
+		ResultsFile string `json:"results_file"`
+		VersionFile string `json:"version_file"`
+	}
+
+	// GetSnapshot describes a dashboard or query snapshot rendered during
+	// get, where true requests a snapshot of the configured query
+	GetSnapshot struct {
+		Dashboard string            `json:"dashboard"`
+		Inputs    map[string]string `json:"inputs"`
+		Output    string            `json:"output" validate:"omitempty,oneof=sps html"`
+
+		// disabled is true if the snapshot was explicitly disabled
+		disabled bool
+	}
 
 	// PutParams describes put step parameters
-	PutParams struct{}
+	PutParams struct {
+		Config          string            `json:"config"`
+		Exports         []string          `json:"exports" validate:"omitempty,dive,oneof=csv html md nunit3 asff json"`
+		Files           map[string]string `json:"files"`
+		Introspect      bool              `json:"introspect"`
+		LogFile         string            `json:"log_file"`
+		Migrate         *Migration        `json:"migrate" validate:"omitempty"`
+		Orchestrate     *Orchestration    `json:"orchestrate" validate:"omitempty"`
+		Scan            bool              `json:"scan"`
+		Selftest        bool              `json:"selftest"`
+		TestMapping     *MappingTest      `json:"test_mapping" validate:"omitempty"`
+		Tags            map[string]string `json:"tags"`
+		UploadArtifacts bool              `json:"upload_artifacts"`
+		Where           string            `json:"where"`
+	}
 )
 
 func (s *Source) Validate(ctx context.Context) error {
 	if s == nil {
 		s = &Source{}
 	}
-	return validator.New().StructCtx(ctx, s)
+	if err := s.applyPreset(); err != nil {
+		return err
+	}
+	if err := s.applyOIDC(); err != nil {
+		return err
+	}
+	if err := s.applyMappingAlias(); err != nil {
+		return err
+	}
+	if err := validator.New().StructCtx(ctx, s); err != nil {
+		return err
+	}
+	if s.Archive != nil {
+		if err := s.Archive.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Signing != nil && s.Archive == nil {
+		return fmt.Errorf("signing requires archive")
+	}
+	if s.Shards != nil && len(s.Shards.Values) > 0 && !s.QueryTemplate {
+		return fmt.Errorf("shards values require query_template")
+	}
+	if len(s.Queries) > 0 && s.Mapping == nil {
+		return fmt.Errorf("mapping or version_mapping is required with queries")
+	}
+	return nil
+}
+
+// Validate get parameters
+func (p *GetParams) Validate(ctx context.Context) error {
+	return validator.New().StructCtx(ctx, p)
+}
+
+// Validate put parameters
+func (p *PutParams) Validate(ctx context.Context) error {
+	return validator.New().StructCtx(ctx, p)
+}
+
+// outputFile returns the configured name of the given default get output
+// file
+func (p *GetParams) outputFile(name string) string {
+	if p == nil || p.Output == nil {
+		return name
+	}
+	switch name {
+	case "diff.json":
+		if p.Output.DiffFile != "" {
+			return p.Output.DiffFile
+		}
+	case "results.json":
+		if p.Output.ResultsFile != "" {
+			return p.Output.ResultsFile
+		}
+	case "version.json":
+		if p.Output.VersionFile != "" {
+			return p.Output.VersionFile
+		}
+	}
+	return name
+}
+
+// apply returns a copy of the given source with any put overrides applied,
+// where exports are written to the given directory
+func (p *PutParams) apply(s *Source, dir string) *Source {
+	if p == nil {
+		return s
+	}
+
+	merged := *s
+	if p.Config != "" {
+		merged.Config = p.Config
+	}
+	if len(p.Files) > 0 {
+		merged.Files = make(map[string]string, len(s.Files)+len(p.Files))
+		for f, content := range s.Files {
+			merged.Files[f] = content
+		}
+		for f, content := range p.Files {
+			merged.Files[f] = content
+		}
+	}
+	if s.Benchmark != nil && (len(p.Tags) > 0 || p.Where != "" || len(p.Exports) > 0) {
+		benchmark := *s.Benchmark
+		if len(p.Tags) > 0 {
+			benchmark.Tags = p.Tags
+		}
+		if p.Where != "" {
+			benchmark.Where = p.Where
+		}
+		for _, format := range p.Exports {
+			benchmark.exports = append(benchmark.exports, path.Join(dir, exportFiles[format]))
+		}
+		merged.Benchmark = &benchmark
+	}
+	return &merged
 }
 
 func (v *Version) MarshalJSON() ([]byte, error) {
@@ -75,174 +390,766 @@ func (v *Version) UnmarshalJSON(b []byte) error {
 // Resource implements a steampipe concourse resource
 type Resource struct {
 	sdk.BaseResource[Source, Version, GetParams, PutParams]
+	audit       *audit
+	cache       cache.Cache
+	checked     *Source
+	failure     *failure
+	initialized bool
+	snapshots   *blob.Store
+	timings     timings
+	transcript  *transcript
+	trigger     trigger.Trigger
+
+	// mu guards initialization and writes to the local filesystem
+	mu sync.Mutex
+	// op serializes resource operations, which share steampipe configuration
+	op sync.Mutex
+	// fmu guards the most recent command failure
+	fmu sync.Mutex
 }
 
 // Archive implements optional method to enable resource version archiving
 func (r *Resource) Archive(ctx context.Context, s *Source) (sdk.Archive, error) {
 	if s != nil && s.Archive != nil {
-		return archive.New(ctx, *s.Archive)
+		a, err := s.Archive.open(ctx, s, false)
+		if err != nil {
+			return nil, err
+		}
+		if s.BuildLinks {
+			a = &linkedArchive{Archive: a}
+		}
+		if s.Signing != nil {
+			a = &signedArchive{Archive: a, s: s}
+		}
+		return &timedArchive{Archive: a, r: r}, nil
 	}
 	return nil, nil
 }
 
 // Initialize configures shared resources
 func (r *Resource) Initialize(ctx context.Context, s *Source) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.initialized {
+		return nil
+	}
+
 	color.NoColor = false
 	color.Output = sdk.StdErrFromContext(ctx)
+
+	// derive resource debug logging and colors from the configured log level
+	// and color mode
+	if s != nil {
+		s.Debug = logEnabled(s, "debug")
+		color.NoColor = noColor(s)
+		for _, d := range s.deprecations {
+			color.Yellow("warning: %s", d)
+		}
+	}
+
+	// configure short-lived cloud credentials from an oidc token
+	if s != nil && s.OIDC != nil {
+		if err := initOIDC(s); err != nil {
+			return err
+		}
+	}
+
+	// initialize audit trail if configured
+	if s != nil && s.Audit != nil {
+		if err := r.initAudit(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	// initialize query result cache if configured
+	if s != nil && s.Cache != nil {
+		cfg := *s.Cache
+		cfg.Debug = cfg.Debug || s.Debug
+		if r.cache, err = cache.New(ctx, &cfg); err != nil {
+			return fmt.Errorf("error initializing cache: %v", err)
+		}
+	}
+
+	// initialize snapshot store if configured
+	if s != nil && s.Snapshots != nil {
+		if r.snapshots, err = blob.New(ctx, s.Snapshots, s.Debug); err != nil {
+			return fmt.Errorf("error initializing snapshot store: %v", err)
+		}
+	}
+
+	// initialize change trigger if configured
+	if s != nil && s.Trigger != nil {
+		cfg := *s.Trigger
+		cfg.Debug = cfg.Debug || s.Debug
+		if r.trigger, err = trigger.New(ctx, &cfg); err != nil {
+			return fmt.Errorf("error initializing trigger: %v", err)
+		}
+	}
+
+	// verify the installed steampipe binary satisfies the version constraint
+	if s != nil && s.SteampipeVersion != "" {
+		if err := r.materialize(s); err != nil {
+			return err
+		}
+		if err := r.verifySteampipe(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	// download remote files
+	if s != nil && hasRemoteFiles(s) {
+		if err := r.materialize(s); err != nil {
+			return err
+		}
+		start := time.Now()
+		if err := r.fetchFiles(ctx, s); err != nil {
+			return err
+		}
+		r.track("files", start)
+	}
+
+	// discover azure subscriptions
+	if s != nil && s.Azure != nil && s.Azure.DiscoverSubscriptions {
+		if err := r.materialize(s); err != nil {
+			return err
+		}
+		if err := discoverSubscriptions(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	// download terraform remote state files
+	if s != nil && s.Terraform != nil && len(s.Terraform.States) > 0 {
+		if err := r.materialize(s); err != nil {
+			return err
+		}
+		if err := r.syncTerraform(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	if s != nil && (len(s.Plugins) > 0 || len(s.PluginBundles) > 0 || len(s.WarmupQueries) > 0) {
+		if err := r.materialize(s); err != nil {
+			return err
+		}
+
+		// install any missing plugins
+		start := time.Now()
+		if err := r.installPlugins(ctx, s); err != nil {
+			return err
+		}
+		r.track("plugins", start)
+
+		// execute warm-up queries to pre-populate plugin schemas and caches
+		start = time.Now()
+		r.warmup(ctx, s)
+		r.track("warmup", start)
+	}
+
+	r.initialized = true
 	return nil
 }
 
 // Check for new versions
 func (r *Resource) Check(ctx context.Context, s *Source, v *Version) (versions []Version, err error) {
+	r.op.Lock()
+	defer r.op.Unlock()
+	// with an archive, timings are reported once the archive closes, after
+	// the sdk archives any new versions
+	if s.Archive != nil {
+		r.checked = s
+	} else {
+		defer r.reportTimings(s)
+	}
+
 	if v != nil {
 		versions = append(versions, *v)
 	}
 
-	// write steampipe config file
-	if err := ioutil.WriteFile(path.Join(configdir, "check.spc"), []byte(s.Config), 0777); err != nil {
-		return nil, fmt.Errorf("error writing configuration: %v", err)
+	// skip the query until the scan interval elapses, regardless of how often
+	// concourse checks, always querying when there is no previous version
+	due, err := r.scanDue(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if !due && v != nil {
+		color.Yellow("scan interval has not elapsed, skipping query...")
+		return versions, nil
 	}
 
-	// write any supporting files
-	for _f, content := range s.Files {
-		// resolve aboslute path
-		f, err := filepath.Abs(_f)
+	// skip the query unless the trigger signalled a change since the last
+	// check, always querying when there is no previous version
+	if r.trigger != nil {
+		pending, err := r.trigger.Pending(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("error resolving absolute path for file '%s': %v", _f, err)
+			return nil, err
 		}
-
-		// create parent directories if not exist
-		dir := path.Dir(f)
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				return nil, fmt.Errorf("error creating file parent directory '%s': %v", dir, err)
-			}
+		if !pending && v != nil {
+			color.Yellow("no change signalled by trigger, skipping query...")
+			return versions, nil
 		}
+	}
+
+	// write steampipe config and any supporting files
+	if err := r.prepare(s); err != nil {
+		return nil, err
+	}
 
-		// write file
-		if err := ioutil.WriteFile(f, []byte(content), 0777); err != nil {
-			return nil, fmt.Errorf("error writing file '%s': %v", f, err)
+	// execute query and derive version data from results, discarding any
+	// failures tolerated during initialization
+	r.fmu.Lock()
+	r.failure = nil
+	r.fmu.Unlock()
+	start := time.Now()
+	var derived []map[string]interface{}
+	if s.Shards != nil && s.Shards.PerTarget {
+		derived, err = r.deriveTargets(ctx, s, v)
+	} else {
+		var data map[string]interface{}
+		if data, _, err = r.derive(ctx, s, v); data != nil {
+			derived = append(derived, data)
 		}
+	}
+	if err != nil {
+		// skip configured classes of errors, retaining the current version
+		if v != nil && r.skipError(s) {
+			color.Red("skipping check after error: %v", err)
+			return versions, nil
+		}
+		return nil, err
+	}
+	if err := r.recordScan(ctx, s, start); err != nil {
+		return nil, err
+	}
 
-		if s.Debug {
-			color.Yellow("wrote custom file: %s", f)
+	// acknowledge the trigger once the query succeeds
+	if r.trigger != nil {
+		if err := r.trigger.Ack(ctx); err != nil {
+			return nil, err
 		}
 	}
 
-	// parse version_mapping if provided
-	var mapping *bloblang.Executor
-	if s.VersionMapping != "" {
-		mapping, err = bloblang.Parse(s.VersionMapping)
+	// append any new versions
+	for _, data := range derived {
+		versions = append(versions, Version{data})
+	}
+
+	return versions, nil
+}
+
+// derive executes the configured query or pipeline and derives version data
+// from the results, returning nil if no version was produced, along with the
+// raw steampipe output
+func (r *Resource) derive(ctx context.Context, s *Source, v *Version) (data map[string]interface{}, out []byte, err error) {
+	// parse version mapping if provided
+	mapping, err := r.loadMapping(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// execute steampipe query, queries, benchmark, or pipeline
+	start := time.Now()
+	if out, err = r.execute(ctx, s, v); err != nil {
+		return nil, nil, err
+	}
+	r.track("query", start)
+
+	data, err = r.deriveResults(ctx, s, v, mapping, out)
+	return data, out, err
+}
+
+// execute executes the configured query, queries, benchmark, or pipeline and
+// returns the raw output
+func (r *Resource) execute(ctx context.Context, s *Source, v *Version) (out []byte, err error) {
+	switch {
+	case len(s.Pipeline) > 0:
+		value, err := r.executePipeline(ctx, s, v)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing version_mapping: %v", err)
+			return nil, err
+		}
+		if out, err = json.Marshal(value); err != nil {
+			return nil, fmt.Errorf("error serializing pipeline result: %v", err)
+		}
+	case s.Shards != nil:
+		rows, err := r.executeShards(ctx, s, v)
+		if err != nil {
+			return nil, err
+		}
+		if out, err = json.Marshal(rows); err != nil {
+			return nil, fmt.Errorf("error serializing sharded result: %v", err)
+		}
+	case s.Benchmark != nil:
+		if out, err = r.benchmark(ctx, s); err != nil {
+			return nil, err
+		}
+	case len(s.Queries) > 0:
+		value, err := r.executeQueries(ctx, s, v)
+		if err != nil {
+			return nil, err
+		}
+		if out, err = json.Marshal(value); err != nil {
+			return nil, fmt.Errorf("error serializing queries result: %v", err)
+		}
+	default:
+		query, err := renderQuery(s, v)
+		if err != nil {
+			return nil, err
+		}
+		if out, err = r.query(ctx, s, query); err != nil {
+			return nil, err
 		}
 	}
+	return out, nil
+}
 
-	// define steampipe environment variables
-	envs := append(os.Environ(), "HOME=/home/steampipe")
-	if s.Debug {
-		envs = append(envs, "STEAMPIPE_LOG_LEVEL=TRACE")
+// deriveResults derives version data from the raw output of the configured
+// query, queries, benchmark, or pipeline, returning nil if no version was
+// produced
+func (r *Resource) deriveResults(ctx context.Context, s *Source, v *Version, mapping mapper, out []byte) (data map[string]interface{}, err error) {
+	// parse query results, flattening benchmark output into control result rows
+	result := gjson.ParseBytes(out)
+	if s.Benchmark != nil {
+		rows, err := json.Marshal(flattenControls(out, s.Benchmark.MinSeverity))
+		if err != nil {
+			return nil, fmt.Errorf("error serializing control results: %v", err)
+		}
+		result = gjson.ParseBytes(rows)
 	}
 
-	// configure steampipe command
-	var outb, errb bytes.Buffer
-	cmd := exec.Command("steampipe", "query", "--output=json", s.Query)
-	cmd.Env = envs
-	cmd.Stdout = &outb
-	cmd.Stderr = &errb
+	// validate query results against the configured schema
+	if err := validateResults(s, result.Value()); err != nil {
+		return nil, err
+	}
 
-	if s.Debug {
-		color.Yellow(cmd.String())
+	// coerce typed columns prior to mapping
+	if result, err = coerceColumns(s, result); err != nil {
+		return nil, err
 	}
 
-	// execute steampipe query
-	err = cmd.Run()
-	if s := outb.String(); s != "" {
-		color.Green(s)
+	// empty results resolve the previous version when emit_resolution is
+	// enabled, unless a mapping or diff is configured, which observe the empty
+	// results first
+	empty := result.IsArray() && len(result.Array()) == 0
+	if result.Type == gjson.Null || (empty && s.EmitResolution && mapping == nil && s.Diff == nil) {
+		color.Yellow("query returned empty result...")
+		return resolution(s, v), nil
 	}
-	if s := errb.String(); s != "" {
-		color.Red(s)
+
+	raw := result.Value()
+
+	// aggregate, sort, and bound the rows available to mapping, while
+	// retaining the full results for diffs, digests, and snapshots
+	after := raw
+	if rows, ok := raw.([]interface{}); ok && (s.Aggregate != nil || len(s.Sort) > 0 || s.Sample != nil) {
+		if rows, err = shapeRows(s, rows); err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing shaped results: %v", err)
+		}
+		after, result = rows, gjson.ParseBytes(b)
 	}
+
+	// retrieve archived query results of previous version if available
+	start := time.Now()
+	snapshot, err := r.loadSnapshot(ctx, v)
 	if err != nil {
-		return nil, fmt.Errorf("error executing query: %v", err)
+		return nil, err
 	}
+	r.track("snapshots", start)
 
-	// parse query results
-	result := gjson.ParseBytes(outb.Bytes())
-	if result.Type == gjson.Null {
-		color.Yellow("query returned null result...")
-		return versions, nil
+	// compute row-level diff against previous results if configured
+	var diff *Diff
+	if s.Diff != nil {
+		if diff, err = diffRows(s.Diff, snapshot, raw); err != nil {
+			return nil, fmt.Errorf("error computing diff: %v", err)
+		}
 	}
 
 	// extract version data from parsed query results
-	var data map[string]interface{}
 	if mapping != nil {
 		// generate mapping input that includes full results as top-level "after" field
 		input := map[string]interface{}{
-			"after": result.Value(),
+			"after": after,
 		}
 		// if a previous version is available, include it as top-level "before" field
+		// along with its archived query results as top-level "before_full" field
 		if v != nil {
 			input["before"] = v.Data
+			if snapshot != nil {
+				input["before_full"] = snapshot
+			}
+		}
+		// if a diff was computed, include it as top-level "diff" field
+		if diff != nil {
+			b, err := json.Marshal(diff)
+			if err != nil {
+				return nil, fmt.Errorf("error serializing diff: %v", err)
+			}
+			input["diff"] = gjson.ParseBytes(b).Value()
 		}
-		if s.Debug {
+		if s.Debug && !s.Quiet {
 			b, _ := json.MarshalIndent(input, "", "  ")
 			color.Yellow("mapping input:\n" + string(b))
 		}
 
 		// execute version mapping
-		out, err := mapping.Query(input)
-		if err != nil && err != bloblang.ErrRootDeleted {
-			return nil, fmt.Errorf("error executing version_mapping: %v", err)
+		start := time.Now()
+		if data, err = mapping.Query(input); err != nil {
+			return nil, err
 		}
-
-		// if mapping result is not empty, rough parse result
-		if out != nil {
-			structured, ok := out.(map[string]interface{})
-			if !ok {
-				return nil, fmt.Errorf("invalid version_mapping result: expected map[string]interface{}, got %T", out)
-			}
-			data = structured
+		r.track("mapping", start)
+	} else if s.Benchmark != nil && s.Benchmark.Summarize {
+		// summarize control results
+		if data, err = summarizeControls(result.Value().([]interface{})); err != nil {
+			return nil, err
 		}
-	} else {
+	} else if !empty {
 		// extract first row
 		if result.IsArray() {
 			result = result.Get("0")
 		}
 
-		// parse row json as version data
-		data = make(map[string]interface{})
-		if err := json.Unmarshal([]byte(result.Raw), &data); err != nil {
-			return nil, fmt.Errorf("error unmarshalling result: %v", err)
+		// project selected columns, or parse row json, as version data
+		if len(s.Select) > 0 {
+			if data, err = selectColumns(s, result); err != nil {
+				return nil, err
+			}
+		} else {
+			data = make(map[string]interface{})
+			if err := json.Unmarshal([]byte(result.Raw), &data); err != nil {
+				return nil, fmt.Errorf("error unmarshalling result: %v", err)
+			}
 		}
 	}
 
-	// if no new version detected, return early
+	// if no version was produced, emit a resolution version if configured,
+	// archiving the cleared results and diff alongside it
 	if data == nil {
-		return versions, nil
+		if data = resolution(s, v); data == nil {
+			return nil, nil
+		}
+		start = time.Now()
+		if err := r.saveSnapshot(ctx, data, raw); err != nil {
+			return nil, err
+		}
+		if err := r.saveDiff(ctx, data, diff); err != nil {
+			return nil, err
+		}
+		r.track("snapshots", start)
+		return data, nil
+	}
+
+	// identify the shard that per-target versions are derived from
+	if s.target != "" {
+		data["target"] = s.target
 	}
 
-	// otherwise, append new version
-	versions = append(versions, Version{data})
+	// normalize string and timestamp values
+	normalizeStrings(s, data)
+	if err := normalizeTimestamps(s, data); err != nil {
+		return nil, err
+	}
 
-	return versions, nil
+	// represent null values according to the configured null policy
+	if err := applyNullPolicy(s, data); err != nil {
+		return nil, err
+	}
+
+	// validate version against the configured schema prior to emission
+	if err := validateVersion(s, data); err != nil {
+		return nil, err
+	}
+
+	// inject digest field if configured
+	if s.DigestField != "" && data != nil {
+		var input interface{} = data
+		if s.DigestSource == digestSourceResults {
+			input = raw
+		}
+		sum, err := digest(input)
+		if err != nil {
+			return nil, err
+		}
+		data[s.DigestField] = sum
+	}
+
+	// enforce version size limits
+	if data, err = enforceVersionSize(s, data); err != nil {
+		return nil, err
+	}
+
+	// archive full query results and diff alongside version
+	start = time.Now()
+	if err := r.saveSnapshot(ctx, data, raw); err != nil {
+		return nil, err
+	}
+	if err := r.saveDiff(ctx, data, diff); err != nil {
+		return nil, err
+	}
+	r.track("snapshots", start)
+	return data, nil
 }
 
-// In serialzies version as JSON and writes it the local filesystem
+// In serialzies version as JSON and writes it the local filesystem, optionally
+// executing an additional query and writing its results alongside the version
 func (r *Resource) In(ctx context.Context, s *Source, v *Version, dir string, p *GetParams) ([]sdk.Metadata, error) {
-	// write version.json
-	vb, err := json.MarshalIndent(v, "", "  ")
-	if err != nil {
-		return nil, fmt.Errorf("error serializing version json: %v", err)
+	r.op.Lock()
+	defer r.op.Unlock()
+
+	// record steampipe stderr output to a log file if requested
+	if p != nil && p.LogFile != "" {
+		r.startTranscript()
+		defer r.writeTranscript(s, dir, p.LogFile)
+	}
+
+	// verify the requested version prior to writing any outputs, which is
+	// implied when archived versions are signed
+	if (p != nil && p.Verify) || s.Signing != nil {
+		if err := r.verifyVersion(ctx, s, v); err != nil {
+			return nil, fmt.Errorf("error verifying version: %v", err)
+		}
+	}
+
+	// write version.json unless omitted
+	if p == nil || p.Output == nil || !p.Output.OmitVersion {
+		vb, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error serializing version json: %v", err)
+		}
+		f := p.outputFile("version.json")
+		if err := ioutil.WriteFile(path.Join(dir, f), vb, artifactFileMode); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", f, err)
+		}
+	}
+
+	// write diff.json if a diff was archived alongside the version
+	if s.Diff != nil {
+		d, err := r.loadDiff(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			f := p.outputFile("diff.json")
+			if err := ioutil.WriteFile(path.Join(dir, f), d, artifactFileMode); err != nil {
+				return nil, fmt.Errorf("error writing %s: %v", f, err)
+			}
+		}
+	}
+
+	// write the full archived query results to results.json if requested
+	if p != nil && p.IncludeResults {
+		if r.snapshots == nil {
+			return nil, fmt.Errorf("include_results requires source.snapshots")
+		}
+		results, err := r.loadSnapshot(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		if results == nil {
+			return nil, fmt.Errorf("no snapshot found for version")
+		}
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error serializing results: %v", err)
+		}
+		f := p.outputFile("results.json")
+		if err := ioutil.WriteFile(path.Join(dir, f), b, artifactFileMode); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", f, err)
+		}
+	}
+
+	// execute get query, or the default get query of the configured preset,
+	// if provided and write results.json
+	getQuery := s.getQuery
+	if p != nil && p.Query != "" {
+		getQuery = p.Query
+	}
+	if p != nil && p.IncludeResults {
+		getQuery = ""
+	}
+	if getQuery != "" {
+		if err := r.prepare(s); err != nil {
+			return nil, err
+		}
+
+		q, err := parseQuery(s, "get", getQuery)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing get query template: %v", err)
+		}
+		data := templateData(s, v)
+		if p != nil {
+			data["args"] = p.Args
+		}
+		query, err := q.render(data)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering get query template: %v", err)
+		}
+
+		out, err := r.query(ctx, s, query)
+		if err != nil {
+			return nil, err
+		}
+		f := p.outputFile("results.json")
+		if err := ioutil.WriteFile(path.Join(dir, f), out, artifactFileMode); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", f, err)
+		}
 	}
-	if err := ioutil.WriteFile(path.Join(dir, "version.json"), vb, 0777); err != nil {
-		return nil, fmt.Errorf("error writing version.json: %v", err)
+
+	// render dashboard or query snapshot if requested
+	if p != nil && p.Snapshot != nil && !p.Snapshot.disabled {
+		if err := r.prepare(s); err != nil {
+			return nil, err
+		}
+		var err error
+		if p.Snapshot.Dashboard != "" {
+			err = r.dashboardSnapshot(ctx, s, v, p, dir)
+		} else {
+			err = r.querySnapshot(ctx, s, v, p, dir)
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return nil, nil
 }
 
-// Out is required but not implemented, and will error if invoked
+// Out executes the configured query, with any config and files overrides
+// applied, and emits the resulting version
 func (r *Resource) Out(ctx context.Context, s *Source, dir string, p *PutParams) (Version, []sdk.Metadata, error) {
-	return Version{}, nil, fmt.Errorf("not implemented")
+	r.op.Lock()
+	defer r.op.Unlock()
+
+	// put params are optional
+	if p == nil {
+		p = &PutParams{}
+	}
+
+	// record steampipe stderr output to a log file if requested
+	if p.LogFile != "" {
+		r.startTranscript()
+		defer r.writeTranscript(s, dir, p.LogFile)
+	}
+
+	// record existing files so that only files written by the step are
+	// uploaded
+	var existing map[string]os.FileInfo
+	if p.UploadArtifacts {
+		if s.Archive == nil || s.Archive.BoltDB == nil {
+			return Version{}, nil, fmt.Errorf("upload_artifacts requires a boltdb archive")
+		}
+		var err error
+		if existing, err = listArtifacts(dir); err != nil {
+			return Version{}, nil, err
+		}
+	}
+
+	version, meta, err := r.put(ctx, s, dir, p)
+	if err != nil || !p.UploadArtifacts {
+		return version, meta, err
+	}
+
+	// upload files written by the step alongside the archived version
+	m, err := r.uploadArtifacts(ctx, s, dir, existing, version)
+	if err != nil {
+		return Version{}, nil, err
+	}
+	return version, append(meta, m...), nil
+}
+
+// put executes the put mode selected by the given params
+func (r *Resource) put(ctx context.Context, s *Source, dir string, p *PutParams) (Version, []sdk.Metadata, error) {
+	// copy archive history between backends in place of executing a query
+	if p.Migrate != nil {
+		return r.migrate(ctx, s, p.Migrate)
+	}
+
+	// dump steampipe introspection files in place of executing a query
+	if p.Introspect {
+		s = p.apply(s, dir)
+		if err := r.prepare(s); err != nil {
+			return Version{}, nil, err
+		}
+		return r.introspect(ctx, s, dir)
+	}
+
+	// test the version mapping against fixtures in place of executing a query
+	if p.TestMapping != nil {
+		s = p.apply(s, dir)
+		if err := r.prepare(s); err != nil {
+			return Version{}, nil, err
+		}
+		return r.testMapping(ctx, s, dir, p.TestMapping)
+	}
+
+	// scan each of the configured targets in place of executing the
+	// configured query once
+	if p.Orchestrate != nil {
+		s = p.apply(s, dir)
+		if err := r.prepare(s); err != nil {
+			return Version{}, nil, err
+		}
+		return r.orchestrate(ctx, s, dir, p.Orchestrate)
+	}
+
+	// validate the archive, plugins, and query execution in place of
+	// executing the configured query
+	if p.Selftest {
+		s = p.apply(s, dir)
+		if err := r.prepare(s); err != nil {
+			return Version{}, nil, err
+		}
+		return r.selftest(ctx, s)
+	}
+
+	s = p.apply(s, dir)
+
+	// write steampipe config and any supporting files
+	if err := r.prepare(s); err != nil {
+		return Version{}, nil, err
+	}
+
+	// always query steampipe when scanning on demand, rather than reusing
+	// cached results
+	if p.Scan {
+		r.cache = nil
+	}
+
+	// execute query and derive version data from results
+	start := time.Now()
+	data, out, err := r.derive(ctx, s, nil)
+	if err != nil {
+		return Version{}, nil, err
+	}
+	if data == nil {
+		return Version{}, nil, fmt.Errorf("query did not produce a version")
+	}
+
+	// record an on-demand scan as the last scan of the polling check, and
+	// acknowledge any change signalled by the trigger
+	var meta []sdk.Metadata
+	if p.Scan {
+		if err := r.recordScan(ctx, s, start); err != nil {
+			return Version{}, nil, err
+		}
+		if r.trigger != nil {
+			if err := r.trigger.Ack(ctx); err != nil {
+				return Version{}, nil, err
+			}
+		}
+		meta = append(meta, sdk.Metadata{Name: "scanned_at", Value: start.UTC().Format(time.RFC3339)})
+	}
+
+	// record all benchmark results, regardless of severity, as metadata and
+	// write them to the output directory
+	if s.Benchmark != nil {
+		meta = append(meta, controlMetadata(out)...)
+		if err := ioutil.WriteFile(path.Join(dir, "check.json"), out, artifactFileMode); err != nil {
+			return Version{}, nil, fmt.Errorf("error writing check.json: %v", err)
+		}
+	}
+
+	return Version{data}, meta, nil
 }
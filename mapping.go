@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/benthosdev/benthos/v4/public/bloblang"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+	"github.com/itchyny/gojq"
+)
+
+// mappingTimeout defines the maximum duration of a remote mapping download
+const mappingTimeout = 30 * time.Second
+
+// defaultMappingLanguage defines the language of mappings that do not
+// specify one
+const defaultMappingLanguage = "bloblang"
+
+type (
+	// Mapping describes a version mapping written in one of the supported
+	// mapping languages, provided inline or loaded from a file
+	Mapping struct {
+		File     string `json:"file"`
+		Language string `json:"language" validate:"omitempty,oneof=bloblang jq"`
+		Source   string `json:"source" validate:"required_without=File,excluded_with=File"`
+	}
+
+	// mapper executes a parsed version mapping
+	mapper interface {
+		// Query executes the mapping against the given input, returning nil if
+		// the mapping produces no version
+		Query(input interface{}) (map[string]interface{}, error)
+	}
+
+	// bloblangMapper executes a bloblang version mapping
+	bloblangMapper struct {
+		exec *bloblang.Executor
+	}
+
+	// jqMapper executes a jq version mapping
+	jqMapper struct {
+		code *gojq.Code
+	}
+)
+
+// mappingLanguages defines the parser of each supported mapping language
+var mappingLanguages = map[string]func(s *Source, text string) (mapper, error){
+	"bloblang": func(s *Source, text string) (mapper, error) {
+		exec, err := parseMapping(s, text)
+		if err != nil {
+			return nil, err
+		}
+		return &bloblangMapper{exec: exec}, nil
+	},
+	"jq": func(s *Source, text string) (mapper, error) {
+		q, err := gojq.Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		code, err := gojq.Compile(q)
+		if err != nil {
+			return nil, err
+		}
+		return &jqMapper{code: code}, nil
+	},
+}
+
+// applyMappingAlias resolves the version_mapping and version_mapping_file
+// aliases into the equivalent bloblang mapping
+func (s *Source) applyMappingAlias() error {
+	if s.VersionMapping == "" && s.VersionMappingFile == "" {
+		return nil
+	}
+	if s.Mapping != nil {
+		return fmt.Errorf("mapping is mutually exclusive with version_mapping and version_mapping_file")
+	}
+	s.Mapping = &Mapping{
+		File:     s.VersionMappingFile,
+		Language: defaultMappingLanguage,
+		Source:   s.VersionMapping,
+	}
+	return nil
+}
+
+// language returns the configured mapping language
+func (m *Mapping) language() string {
+	if m.Language == "" {
+		return defaultMappingLanguage
+	}
+	return m.Language
+}
+
+// versionMapping returns the configured version mapping source, loading it
+// from the mapping file if specified, which is either a local path (e.g. a file
+// delivered via files), an http(s) url, or an s3://bucket/key url with an
+// optional region query parameter
+func (r *Resource) versionMapping(ctx context.Context, s *Source) (string, error) {
+	if s.Mapping == nil {
+		return "", nil
+	}
+	if s.Mapping.File == "" {
+		return s.Mapping.Source, nil
+	}
+
+	u, err := url.Parse(s.Mapping.File)
+	if err != nil {
+		return "", fmt.Errorf("invalid mapping file: %v", err)
+	}
+
+	var b []byte
+	switch u.Scheme {
+	case "http", "https":
+		b, err = fetchMapping(ctx, u.String())
+	case "s3":
+		b, err = downloadMapping(ctx, u)
+	default:
+		f := s.Mapping.File
+		if !filepath.IsAbs(f) {
+			wd, err := workDir(s)
+			if err != nil {
+				return "", fmt.Errorf("error resolving working directory: %v", err)
+			}
+			f = filepath.Join(wd, f)
+		}
+		b, err = ioutil.ReadFile(f)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error loading mapping file '%s': %v", s.Mapping.File, err)
+	}
+	return string(b), nil
+}
+
+// fetchMapping downloads a mapping via http
+func fetchMapping(ctx context.Context, u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, mappingTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", res.StatusCode)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// downloadMapping downloads a mapping from s3
+func downloadMapping(ctx context.Context, u *url.URL) ([]byte, error) {
+	store, err := blob.New(ctx, &blob.Config{Bucket: u.Host, Region: u.Query().Get("region")}, false)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("object not found: %s", key)
+	}
+	return obj.Body, nil
+}
+
+// parseMapping parses a bloblang mapping, resolving any import statements
+// against files configured via files prior to the working directory, so that
+// shared mapping libraries can be included by multiple resources, and with
+// additional methods (e.g. semver_compare) available
+func parseMapping(s *Source, text string) (*bloblang.Executor, error) {
+	env := bloblang.NewEnvironment().WithCustomImporter(func(name string) ([]byte, error) {
+		for _, f := range []string{name, filepath.Clean(name)} {
+			if content, ok := s.Files[f]; ok {
+				return []byte(content), nil
+			}
+		}
+		f := name
+		if !filepath.IsAbs(f) {
+			wd, err := workDir(s)
+			if err != nil {
+				return nil, fmt.Errorf("error resolving working directory: %v", err)
+			}
+			f = filepath.Join(wd, f)
+		}
+		return ioutil.ReadFile(f)
+	})
+	if err := registerSemver(env); err != nil {
+		return nil, fmt.Errorf("error registering mapping methods: %v", err)
+	}
+	return env.Parse(text)
+}
+
+// loadMapping loads and parses the configured version mapping, returning nil
+// if no mapping is configured
+func (r *Resource) loadMapping(ctx context.Context, s *Source) (mapper, error) {
+	text, err := r.versionMapping(ctx, s)
+	if err != nil || text == "" {
+		return nil, err
+	}
+	mapping, err := parseVersionMapping(s, text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing mapping: %v", err)
+	}
+	return mapping, nil
+}
+
+// parseVersionMapping parses a version mapping written in the configured
+// mapping language
+func parseVersionMapping(s *Source, text string) (mapper, error) {
+	parse, ok := mappingLanguages[s.Mapping.language()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported mapping language '%s'", s.Mapping.language())
+	}
+	return parse(s, text)
+}
+
+// Query executes the bloblang mapping against the given input, returning nil
+// if the mapping deletes the root
+func (m *bloblangMapper) Query(input interface{}) (map[string]interface{}, error) {
+	out, err := m.exec.Query(input)
+	if err != nil && err != bloblang.ErrRootDeleted {
+		return nil, fmt.Errorf("error executing mapping: %v", err)
+	}
+
+	// if mapping result is not empty, rough parse result
+	if out == nil {
+		return nil, nil
+	}
+	structured, ok := out.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid mapping result: expected map[string]interface{}, got %T", out)
+	}
+	return structured, nil
+}
+
+// Query executes the jq mapping against the given input, where the first
+// value emitted by the program is the version, and null or no value produces
+// no version
+func (m *jqMapper) Query(input interface{}) (map[string]interface{}, error) {
+	// normalize the input to the json types supported by jq
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing mapping input: %v", err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, fmt.Errorf("error parsing mapping input: %v", err)
+	}
+
+	out, ok := m.code.Run(normalized).Next()
+	if !ok || out == nil {
+		return nil, nil
+	}
+	if err, ok := out.(error); ok {
+		return nil, fmt.Errorf("error executing mapping: %v", err)
+	}
+	structured, ok := out.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid mapping result: expected map[string]interface{}, got %T", out)
+	}
+	return structured, nil
+}
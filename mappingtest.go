@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+)
+
+// MappingTest describes a put step that executes the version mapping against
+// sample fixtures, where fixture paths are relative to the put directory
+type MappingTest struct {
+	After    string `json:"after" validate:"required"`
+	Before   string `json:"before"`
+	Expected string `json:"expected"`
+}
+
+// testMapping executes the version mapping against the configured fixtures,
+// failing if the mapping fails or its result does not match the expected
+// fixture, and emits a version describing the test
+func (r *Resource) testMapping(ctx context.Context, s *Source, dir string, t *MappingTest) (Version, []sdk.Metadata, error) {
+	text, err := r.versionMapping(ctx, s)
+	if err != nil {
+		return Version{}, nil, err
+	}
+	if text == "" {
+		return Version{}, nil, fmt.Errorf("mapping test requires mapping or version_mapping")
+	}
+	mapping, err := parseVersionMapping(s, text)
+	if err != nil {
+		return Version{}, nil, fmt.Errorf("error parsing mapping: %v", err)
+	}
+
+	// load fixtures
+	input := make(map[string]interface{})
+	if input["after"], err = readFixture(dir, t.After); err != nil {
+		return Version{}, nil, err
+	}
+	if t.Before != "" {
+		if input["before"], err = readFixture(dir, t.Before); err != nil {
+			return Version{}, nil, err
+		}
+	}
+
+	result, err := mapping.Query(input)
+	if err != nil {
+		return Version{}, nil, err
+	}
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return Version{}, nil, fmt.Errorf("error serializing mapping result: %v", err)
+	}
+	if !s.Quiet {
+		color.Yellow("mapping result:\n%s", string(b))
+	}
+
+	// compare against expected result through a json round trip
+	if t.Expected != "" {
+		expected, err := readFixture(dir, t.Expected)
+		if err != nil {
+			return Version{}, nil, err
+		}
+		var actual interface{}
+		if err := json.Unmarshal(b, &actual); err != nil {
+			return Version{}, nil, fmt.Errorf("error parsing mapping result: %v", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			e, _ := json.MarshalIndent(expected, "", "  ")
+			return Version{}, nil, fmt.Errorf("mapping result does not match expected fixture '%s', expected:\n%s", t.Expected, string(e))
+		}
+	}
+
+	version := Version{map[string]interface{}{
+		"mapping_test": "passed",
+		"tested_at":    time.Now().UTC().Format(time.RFC3339),
+	}}
+	if s.Quiet {
+		return version, nil, nil
+	}
+	return version, []sdk.Metadata{{Name: "result", Value: string(b)}}, nil
+}
+
+// readFixture reads and parses a json fixture relative to the given directory
+func readFixture(dir, name string) (interface{}, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixture '%s': %v", name, err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("error parsing fixture '%s': %v", name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/archive"
+)
+
+// Migration describes a put step that copies archived version history
+// between archive backends
+type Migration struct {
+	From *ArchiveConfig `json:"from" validate:"required"`
+	To   *ArchiveConfig `json:"to" validate:"required"`
+}
+
+// migrate copies archived version history between archive backends, emitting
+// a version that records the number of versions migrated
+func (r *Resource) migrate(ctx context.Context, s *Source, m *Migration) (Version, []sdk.Metadata, error) {
+	for _, c := range []*ArchiveConfig{m.From, m.To} {
+		if err := c.validate(); err != nil {
+			return Version{}, nil, err
+		}
+	}
+
+	// objects are copied as stored, except that the envelope of the s3 archive
+	// is only retained when migrating to another s3 archive, as the sdk
+	// backends store versions as is
+	src, err := openIsolated(ctx, m.From, s, m.To.S3 != nil)
+	if err != nil {
+		return Version{}, nil, fmt.Errorf("error initializing source archive: %v", err)
+	}
+	defer src.Close(ctx)
+	dst, err := openIsolated(ctx, m.To, s, true)
+	if err != nil {
+		return Version{}, nil, fmt.Errorf("error initializing destination archive: %v", err)
+	}
+
+	start := time.Now()
+	n, err := archive.Migrate(ctx, src, dst)
+	if err != nil {
+		dst.Close(ctx)
+		return Version{}, nil, fmt.Errorf("error migrating archive after %d versions: %v", n, err)
+	}
+	// the boltdb backend persists the database when closed
+	if err := dst.Close(ctx); err != nil {
+		return Version{}, nil, fmt.Errorf("error closing destination archive: %v", err)
+	}
+	color.Yellow("migrated %d archived versions in %s", n, time.Since(start))
+
+	version := Version{map[string]interface{}{
+		"migrated":    fmt.Sprint(n),
+		"migrated_at": start.UTC().Format(time.RFC3339),
+	}}
+	return version, []sdk.Metadata{{Name: "migrated", Value: fmt.Sprint(n)}}, nil
+}
+
+// isolatedArchive describes an archive opened within its own working
+// directory
+type isolatedArchive struct {
+	sdk.Archive
+	dir string
+}
+
+// openIsolated opens the archive within a temporary working directory, as the
+// boltdb backend stores its database file in the working directory, which
+// would otherwise be shared with source.archive and the other archive of the
+// migration
+func openIsolated(ctx context.Context, c *ArchiveConfig, s *Source, raw bool) (sdk.Archive, error) {
+	if c.BoltDB == nil {
+		return c.open(ctx, s, raw)
+	}
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		return nil, fmt.Errorf("error creating archive directory: %v", err)
+	}
+	var a sdk.Archive
+	err = inDir(dir, func() (err error) {
+		a, err = c.open(ctx, s, raw)
+		return err
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &isolatedArchive{Archive: a, dir: dir}, nil
+}
+
+func (a *isolatedArchive) Close(ctx context.Context) error {
+	defer os.RemoveAll(a.dir)
+	return inDir(a.dir, func() error {
+		return a.Archive.Close(ctx)
+	})
+}
+
+// inDir invokes fn with the working directory set to dir
+func inDir(dir string, fn func() error) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error retrieving working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("error changing working directory: %v", err)
+	}
+	defer os.Chdir(wd)
+	return fn()
+}
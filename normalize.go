@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// invisibleChars defines zero-width and byte order mark characters trimmed
+// along with whitespace
+const invisibleChars = "\u200b\u200c\u200d\u2060\ufeff"
+
+// StringNormalization describes how string version values are normalized
+type StringNormalization struct {
+	NFC  bool `json:"nfc"`
+	Trim bool `json:"trim"`
+}
+
+// normalizeStrings trims leading and trailing whitespace and invisible
+// characters from, and applies unicode nfc normalization to, string version
+// values, including those nested within objects and arrays
+func normalizeStrings(s *Source, data map[string]interface{}) {
+	if s.NormalizeStrings == nil {
+		return
+	}
+	for k, v := range data {
+		data[k] = normalizeValue(s.NormalizeStrings, v)
+	}
+}
+
+// normalizeValue recursively normalizes the string values of a json value
+func normalizeValue(n *StringNormalization, v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		if n.Trim {
+			x = strings.TrimFunc(x, func(r rune) bool {
+				return unicode.IsSpace(r) || strings.ContainsRune(invisibleChars, r)
+			})
+		}
+		if n.NFC {
+			x = norm.NFC.String(x)
+		}
+		return x
+	case map[string]interface{}:
+		for k, val := range x {
+			x[k] = normalizeValue(n, val)
+		}
+	case []interface{}:
+		for i, val := range x {
+			x[i] = normalizeValue(n, val)
+		}
+	}
+	return v
+}
+
+// Timestamps describes how timestamp version values are normalized
+type Timestamps struct {
+	Fields   []string `json:"fields"`
+	Format   string   `json:"format"`
+	Location string   `json:"location"`
+}
+
+// normalizeTimestamps reformats timestamp version values in UTC using the
+// configured format (RFC3339 by default), where the configured fields are
+// required to be timestamps or unix epochs, and otherwise any top-level
+// string value that parses as a timestamp with a time component is
+// normalized
+func normalizeTimestamps(s *Source, data map[string]interface{}) error {
+	t := s.Timestamps
+	if t == nil {
+		return nil
+	}
+
+	loc := time.UTC
+	if t.Location != "" {
+		var err error
+		if loc, err = time.LoadLocation(t.Location); err != nil {
+			return fmt.Errorf("invalid timestamps.location: %v", err)
+		}
+	}
+	format := time.RFC3339Nano
+	if t.Format != "" {
+		format = t.Format
+	}
+
+	if len(t.Fields) > 0 {
+		for _, k := range t.Fields {
+			v, ok := data[k]
+			if !ok || v == nil {
+				continue
+			}
+			ts, err := parseTime(v, loc)
+			if err != nil {
+				return fmt.Errorf("error normalizing timestamp field '%s': %v", k, err)
+			}
+			data[k] = ts.UTC().Format(format)
+		}
+		return nil
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// ignore date-only and other short values that are unlikely to be
+		// timestamps
+		if v, ok := data[k].(string); ok && len(v) > len("2006-01-02") {
+			if ts, err := parseTime(v, loc); err == nil {
+				data[k] = ts.UTC().Format(format)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// supported null policies
+const (
+	nullPolicyEmpty = "empty"
+	nullPolicyError = "error"
+	nullPolicyNull  = "null"
+	nullPolicyOmit  = "omit"
+)
+
+// applyNullPolicy replaces the null values of version data according to the
+// configured null policy, so that plugins intermittently returning nulls do
+// not produce unstable versions
+func applyNullPolicy(s *Source, data map[string]interface{}) error {
+	if s.NullPolicy == "" {
+		return nil
+	}
+
+	var nulls []string
+	for k, v := range data {
+		if v == nil {
+			nulls = append(nulls, k)
+		}
+	}
+	sort.Strings(nulls)
+
+	for _, k := range nulls {
+		switch s.NullPolicy {
+		case nullPolicyEmpty:
+			data[k] = ""
+		case nullPolicyError:
+			return fmt.Errorf("version field '%s' is null or missing", k)
+		case nullPolicyNull:
+			data[k] = "null"
+		case nullPolicyOmit:
+			delete(data, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// defaultRoleSessionName defines the default session name of assumed aws roles
+const defaultRoleSessionName = "concourse-steampipe-resource"
+
+// OIDC describes an oidc token (e.g. issued by the concourse idtoken var
+// source) that is exchanged for short-lived cloud credentials
+type OIDC struct {
+	AWS       *OIDCAWS `json:"aws" validate:"omitempty"`
+	Azure     bool     `json:"azure"`
+	GCP       *OIDCGCP `json:"gcp" validate:"omitempty"`
+	Token     string   `json:"token" validate:"required_without=TokenFile,excluded_with=TokenFile"`
+	TokenFile string   `json:"token_file"`
+}
+
+// OIDCAWS describes an aws role assumed via web identity federation
+type OIDCAWS struct {
+	RoleARN         string `json:"role_arn" validate:"required"`
+	RoleSessionName string `json:"role_session_name"`
+}
+
+// OIDCGCP describes a gcp workload identity pool provider, and optional
+// service account to impersonate
+type OIDCGCP struct {
+	Audience       string `json:"audience" validate:"required"`
+	ServiceAccount string `json:"service_account"`
+}
+
+// oidcTokenFile returns the path of the oidc token file
+func oidcTokenFile(s *Source) string {
+	if s.OIDC.TokenFile != "" {
+		return s.OIDC.TokenFile
+	}
+	return path.Join(homeDir(s), ".oidc", "token")
+}
+
+// applyOIDC configures gcp and azure credentials to be derived from the oidc
+// token, and must be called prior to validation
+func (s *Source) applyOIDC() error {
+	o := s.OIDC
+	if o == nil {
+		return nil
+	}
+
+	if o.GCP != nil {
+		if s.GCP == nil {
+			s.GCP = &GCP{}
+		}
+		if s.GCP.Credentials != "" {
+			return fmt.Errorf("oidc.gcp cannot be used with gcp.credentials")
+		}
+		creds := map[string]interface{}{
+			"type":               "external_account",
+			"audience":           o.GCP.Audience,
+			"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+			"token_url":          "https://sts.googleapis.com/v1/token",
+			"credential_source":  map[string]interface{}{"file": oidcTokenFile(s)},
+		}
+		if o.GCP.ServiceAccount != "" {
+			creds["service_account_impersonation_url"] = fmt.Sprintf("https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken", o.GCP.ServiceAccount)
+		}
+		b, err := json.Marshal(creds)
+		if err != nil {
+			return fmt.Errorf("error rendering gcp external account credentials: %v", err)
+		}
+		s.GCP.Credentials = string(b)
+	}
+
+	if o.Azure {
+		a := s.Azure
+		if a == nil {
+			return fmt.Errorf("oidc.azure requires azure")
+		}
+		if a.ClientSecret != "" || a.Certificate != "" || a.FederatedToken != "" || a.FederatedTokenFile != "" {
+			return fmt.Errorf("oidc.azure cannot be used with other azure credentials")
+		}
+		a.FederatedTokenFile = oidcTokenFile(s)
+	}
+	return nil
+}
+
+// initOIDC writes the oidc token, if not injected as a file, and configures
+// the process environment such that all aws clients (including those used
+// by steampipe plugins, archives, caches, and snapshots) assume the
+// configured role via web identity federation
+func initOIDC(s *Source) error {
+	o := s.OIDC
+	f := oidcTokenFile(s)
+	if o.Token != "" {
+		if err := os.MkdirAll(path.Dir(f), 0700); err != nil {
+			return fmt.Errorf("error creating oidc token directory: %v", err)
+		}
+		if err := writeFile(f, strings.NewReader(o.Token), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing oidc token: %v", err)
+		}
+	}
+
+	// fail early on expired tokens rather than with opaque provider errors
+	token, err := ioutil.ReadFile(f)
+	if err != nil {
+		return fmt.Errorf("error reading oidc token: %v", err)
+	}
+	claims, err := tokenClaims(string(token))
+	if err != nil {
+		return fmt.Errorf("invalid oidc token: %v", err)
+	}
+	if claims.Expiry > 0 {
+		exp := time.Unix(claims.Expiry, 0).UTC()
+		if time.Now().After(exp) {
+			return fmt.Errorf("oidc token expired at %s", exp.Format(time.RFC3339))
+		}
+		if s.Debug {
+			color.Yellow("using oidc token for subject '%s' expiring at %s", claims.Subject, exp.Format(time.RFC3339))
+		}
+	}
+
+	if o.AWS != nil {
+		name := o.AWS.RoleSessionName
+		if name == "" {
+			name = defaultRoleSessionName
+		}
+		for k, v := range map[string]string{
+			"AWS_ROLE_ARN":                o.AWS.RoleARN,
+			"AWS_ROLE_SESSION_NAME":       name,
+			"AWS_WEB_IDENTITY_TOKEN_FILE": f,
+		} {
+			if err := os.Setenv(k, v); err != nil {
+				return fmt.Errorf("error setting %s: %v", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// oidcClaims describes the oidc token claims used for diagnostics
+type oidcClaims struct {
+	Expiry  int64  `json:"exp"`
+	Subject string `json:"sub"`
+}
+
+// tokenClaims decodes the claims of a jwt without verifying its signature,
+// which is left to the relying cloud provider
+func tokenClaims(token string) (*oidcClaims, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected jwt with 3 segments, got %d", len(parts))
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding claims: %v", err)
+	}
+	var claims oidcClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, fmt.Errorf("error parsing claims: %v", err)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// targetsDir defines the output subdirectory that per-target results are
+// written to
+const targetsDir = "targets"
+
+// unsafeTargetChars matches characters replaced in per-target file names
+var unsafeTargetChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+type (
+	// Orchestration describes a put step that executes the configured query
+	// once per target (e.g. account, region, or project), bounded by the
+	// configured parallelism, writing a consolidated report and per-target
+	// results to the put directory
+	Orchestration struct {
+		AllowFailures bool     `json:"allow_failures"`
+		Connections   []string `json:"connections" validate:"required_without=Values,excluded_with=Values"`
+		Parallelism   int      `json:"parallelism" validate:"gte=0"`
+		Values        []string `json:"values" validate:"required_without=Connections"`
+	}
+
+	// orchestrationReport describes the consolidated report of an
+	// orchestrated scan
+	orchestrationReport struct {
+		Failed    int            `json:"failed"`
+		Rows      int            `json:"rows"`
+		ScannedAt string         `json:"scanned_at"`
+		Targets   []targetResult `json:"targets"`
+	}
+
+	// targetResult describes the outcome of scanning a single target
+	targetResult struct {
+		Duration string `json:"duration"`
+		Error    string `json:"error,omitempty"`
+		File     string `json:"file,omitempty"`
+		Rows     int    `json:"rows"`
+		Status   string `json:"status"`
+		Target   string `json:"target"`
+	}
+)
+
+// targets returns the configured targets, and whether they are connections
+func (o *Orchestration) targets() ([]string, bool) {
+	if len(o.Connections) > 0 {
+		return o.Connections, true
+	}
+	return o.Values, false
+}
+
+// orchestrate executes the configured query once per target, writing the
+// rows of each target to the targets directory, the union of all rows to
+// results.json, and a summary of each target to report.json, and emits a
+// version that records the number of targets, rows, and failures
+func (r *Resource) orchestrate(ctx context.Context, s *Source, dir string, o *Orchestration) (Version, []sdk.Metadata, error) {
+	if s.Query == "" {
+		return Version{}, nil, fmt.Errorf("orchestrate requires query")
+	}
+	if len(o.Values) > 0 && !s.QueryTemplate {
+		return Version{}, nil, fmt.Errorf("orchestrate values require query_template")
+	}
+	q, err := parseQuery(s, "query", s.Query)
+	if err != nil {
+		return Version{}, nil, fmt.Errorf("error parsing query template: %v", err)
+	}
+	out := path.Join(dir, targetsDir)
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return Version{}, nil, fmt.Errorf("error creating targets directory: %v", err)
+	}
+
+	targets, useConnections := o.targets()
+	results, rows := make([]targetResult, len(targets)), make([][]interface{}, len(targets))
+	start := time.Now()
+
+	// scan each target, recording failures rather than returning them so that
+	// a single failed target does not prevent the remaining targets from
+	// being scanned
+	forEach(o.Parallelism, len(targets), func(i int) error {
+		target, tstart := targets[i], time.Now()
+		results[i].Target = target
+		defer func() {
+			results[i].Duration = time.Since(tstart).Round(time.Millisecond).String()
+		}()
+
+		result, err := r.scanTarget(ctx, s, q, target, useConnections)
+		if err != nil {
+			results[i].Status, results[i].Error = "failed", err.Error()
+			color.Red("error scanning target '%s': %v", target, err)
+			return nil
+		}
+		switch {
+		case result.IsArray():
+			rows[i] = result.Value().([]interface{})
+		case result.Type != gjson.Null:
+			rows[i] = []interface{}{result.Value()}
+		}
+
+		// write target rows
+		f := targetFile(target)
+		b, err := json.MarshalIndent(rows[i], "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(path.Join(out, f), b, artifactFileMode)
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = "failed", fmt.Sprintf("error writing results: %v", err)
+			color.Red("error writing results of target '%s': %v", target, err)
+			return nil
+		}
+		results[i].File, results[i].Rows, results[i].Status = path.Join(targetsDir, f), len(rows[i]), "ok"
+		color.Yellow("scanned target '%s': %d rows in %s", target, len(rows[i]), time.Since(tstart).Round(time.Millisecond))
+		return nil
+	})
+
+	// write consolidated results and report
+	report := orchestrationReport{
+		ScannedAt: start.UTC().Format(time.RFC3339),
+		Targets:   results,
+	}
+	union := []interface{}{}
+	var failed []string
+	for i, result := range results {
+		union = append(union, rows[i]...)
+		report.Rows += result.Rows
+		if result.Status == "failed" {
+			failed = append(failed, result.Target)
+		}
+	}
+	report.Failed = len(failed)
+	for name, v := range map[string]interface{}{"results.json": union, "report.json": report} {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return Version{}, nil, fmt.Errorf("error serializing %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name), b, artifactFileMode); err != nil {
+			return Version{}, nil, fmt.Errorf("error writing %s: %v", name, err)
+		}
+	}
+	if len(failed) > 0 && !o.AllowFailures {
+		return Version{}, nil, fmt.Errorf("error scanning %d of %d targets: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+
+	version := Version{map[string]interface{}{
+		"failed":     fmt.Sprint(report.Failed),
+		"rows":       fmt.Sprint(report.Rows),
+		"scanned_at": report.ScannedAt,
+		"targets":    fmt.Sprint(len(targets)),
+	}}
+	meta := []sdk.Metadata{
+		{Name: "targets", Value: fmt.Sprint(len(targets))},
+		{Name: "rows", Value: fmt.Sprint(report.Rows)},
+		{Name: "failed", Value: fmt.Sprint(report.Failed)},
+	}
+	return version, meta, nil
+}
+
+// targetFile returns the name of the results file of the given target, where
+// a short hash of the target keeps names unique after unsafe characters are
+// replaced (e.g. a/b and a_b)
+func targetFile(target string) string {
+	sum := sha256.Sum256([]byte(target))
+	return unsafeTargetChars.ReplaceAllString(target, "_") + "-" + hex.EncodeToString(sum[:4]) + ".json"
+}
+
+// scanTarget executes the query template for a single target, which is
+// available to the template as .target, restricting connection targets via
+// search path
+func (r *Resource) scanTarget(ctx context.Context, s *Source, q *queryTemplate, target string, useConnection bool) (gjson.Result, error) {
+	data := templateData(s, nil)
+	data["target"] = target
+	query, err := q.render(data)
+	if err != nil {
+		return gjson.Result{}, fmt.Errorf("error rendering query template: %v", err)
+	}
+
+	var args []string
+	if useConnection {
+		args = append(args, "--search-path-prefix="+target)
+	}
+	out, err := r.query(ctx, s, query, args...)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	if !gjson.ValidBytes(out) {
+		return gjson.Result{}, fmt.Errorf("invalid query output")
+	}
+	return gjson.ParseBytes(out), nil
+}
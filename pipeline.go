@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/benthosdev/benthos/v4/public/bloblang"
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// executePipeline executes each configured pipeline stage in order, providing
+// the output of each stage as input to the next, and returns the output of the
+// final stage
+func (r *Resource) executePipeline(ctx context.Context, s *Source, v *Version) (interface{}, error) {
+	// parse all stages prior to executing any queries
+	queries := make([]*queryTemplate, len(s.Pipeline))
+	mappings := make([]*bloblang.Executor, len(s.Pipeline))
+	for i, stage := range s.Pipeline {
+		if stage.Query != "" {
+			q, err := parseQuery(s, stageName(i, stage), stage.Query)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing pipeline stage '%s' query: %v", stageName(i, stage), err)
+			}
+			queries[i] = q
+		} else {
+			m, err := parseMapping(s, stage.Mapping)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing pipeline stage '%s' mapping: %v", stageName(i, stage), err)
+			}
+			mappings[i] = m
+		}
+	}
+
+	var result interface{}
+	stages := make(map[string]interface{}, len(s.Pipeline))
+	for i, stage := range s.Pipeline {
+		name := stageName(i, stage)
+		if s.Debug {
+			color.Yellow("executing pipeline stage: %s", name)
+		}
+
+		if q := queries[i]; q != nil {
+			// render stage query using the results of previous stages
+			data := templateData(s, v)
+			data["result"], data["stages"] = result, stages
+			query, err := q.render(data)
+			if err != nil {
+				return nil, fmt.Errorf("error rendering pipeline stage '%s' query: %v", name, err)
+			}
+
+			out, err := r.query(ctx, s, query)
+			if err != nil {
+				return nil, fmt.Errorf("error executing pipeline stage '%s': %v", name, err)
+			}
+			result = gjson.ParseBytes(out).Value()
+		} else {
+			// transform previous stage results
+			out, err := mappings[i].Query(result)
+			if err != nil && err != bloblang.ErrRootDeleted {
+				return nil, fmt.Errorf("error executing pipeline stage '%s' mapping: %v", name, err)
+			}
+			result = out
+		}
+
+		if stage.Name != "" {
+			stages[stage.Name] = result
+		}
+	}
+	return result, nil
+}
+
+// stageName returns the configured stage name, or its index if unnamed
+func stageName(i int, stage PipelineStage) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+	return strconv.Itoa(i)
+}
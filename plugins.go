@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// defaultPluginRegistry defines the registry host steampipe uses for plugin
+// references that do not include one
+const defaultPluginRegistry = "hub.steampipe.io/plugins"
+
+// pluginRef resolves a plugin reference (e.g. aws, turbot/aws@0.80) to a fully
+// qualified image reference within the configured registry
+func pluginRef(s *Source, plugin string) string {
+	registry := defaultPluginRegistry
+	if s.PluginRegistry != nil {
+		registry = s.PluginRegistry.host()
+	}
+
+	ref := plugin
+	if !strings.Contains(ref, "/") {
+		ref = "turbot/" + ref
+	}
+	if !strings.Contains(ref, "@") {
+		ref += "@latest"
+	}
+	return registry + "/" + ref
+}
+
+// host returns the registry url without scheme or trailing slashes
+func (p *PluginRegistry) host() string {
+	u := strings.TrimPrefix(strings.TrimPrefix(p.URL, "https://"), "http://")
+	return strings.TrimRight(u, "/")
+}
+
+// writeRegistryAuth writes a docker configuration file containing the plugin
+// registry credentials, which is used when pulling plugin images
+func writeRegistryAuth(s *Source) error {
+	if s.PluginRegistry == nil || s.PluginRegistry.Username == "" {
+		return nil
+	}
+
+	host := strings.SplitN(s.PluginRegistry.host(), "/", 2)[0]
+	auth := base64.StdEncoding.EncodeToString([]byte(s.PluginRegistry.Username + ":" + s.PluginRegistry.Password))
+	b, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			host: map[string]string{"auth": auth},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error serializing plugin registry credentials: %v", err)
+	}
+
+	dir := path.Join(homeDir(s), ".docker")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error creating docker config directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "config.json"), b, 0600); err != nil {
+		return fmt.Errorf("error writing plugin registry credentials: %v", err)
+	}
+	return nil
+}
+
+// installPlugins installs any configured plugins that are not already present
+// in the install directory
+func (r *Resource) installPlugins(ctx context.Context, s *Source) error {
+	// install offline bundles first, which take precedence over the registry
+	bundled := make(map[string]struct{}, len(s.PluginBundles))
+	for _, b := range s.PluginBundles {
+		if err := installBundle(s, b); err != nil {
+			return err
+		}
+		bundled[b.Plugin] = struct{}{}
+	}
+
+	var pending []string
+	for _, plugin := range s.Plugins {
+		if _, ok := bundled[plugin]; !ok {
+			pending = append(pending, plugin)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := writeRegistryAuth(s); err != nil {
+		return err
+	}
+
+	for _, plugin := range pending {
+		ref := pluginRef(s, plugin)
+		if _, err := os.Stat(path.Join(installDir(s), "plugins", ref)); err == nil {
+			if s.Debug {
+				color.Yellow("plugin already installed: %s", ref)
+			}
+			continue
+		}
+
+		color.Yellow("installing plugin: %s", ref)
+		_, stderr, err := r.run(ctx, s, "plugin", "install", ref)
+		if err != nil {
+			return fmt.Errorf("error installing plugin '%s': %v\n%s", ref, err, string(stderr))
+		}
+	}
+	return nil
+}
+
+// installBundle installs a pre-downloaded, gzipped plugin binary into the
+// install directory without contacting a registry
+func installBundle(s *Source, b PluginBundle) error {
+	ref := pluginRef(s, b.Plugin)
+	name := path.Base(strings.SplitN(ref, "@", 2)[0])
+	dir := path.Join(installDir(s), "plugins", ref)
+	target := path.Join(dir, fmt.Sprintf("steampipe-plugin-%s.plugin", name))
+	if _, err := os.Stat(target); err == nil {
+		if s.Debug {
+			color.Yellow("plugin bundle already installed: %s", ref)
+		}
+		return nil
+	}
+
+	// read the bundle from the local filesystem or inline content
+	var raw []byte
+	var err error
+	if b.Path != "" {
+		raw, err = ioutil.ReadFile(b.Path)
+	} else {
+		raw, err = base64.StdEncoding.DecodeString(b.Content)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading plugin bundle '%s': %v", b.Plugin, err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("error decompressing plugin bundle '%s': %v", b.Plugin, err)
+	}
+	defer zr.Close()
+
+	color.Yellow("installing plugin bundle: %s", ref)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating plugin directory '%s': %v", dir, err)
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("error writing plugin bundle '%s': %v", b.Plugin, err)
+	}
+	if _, err := io.Copy(out, zr); err != nil {
+		out.Close()
+		os.Remove(target)
+		return fmt.Errorf("error writing plugin bundle '%s': %v", b.Plugin, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// preset describes a named configuration for a common use case, where any
+// part may be overridden by the corresponding source field
+type preset struct {
+	DigestField    string
+	DigestSource   string
+	GetQuery       bool
+	Plugins        []string
+	Query          string
+	Required       []string
+	Vars           map[string]interface{}
+	VersionMapping string
+}
+
+// presets defines the supported named presets
+var presets = map[string]preset{
+	// aws_ami emits the newest available AMI owned by the given account that
+	// matches the configured name pattern and architecture
+	"aws_ami": {
+		Plugins: []string{"aws"},
+		Query: `select image_id, name, creation_date, architecture, region
+from aws_ec2_ami_shared
+where owner_id = {{ quote .vars.owner }}
+  and state = 'available'
+  and architecture = {{ quote .vars.architecture }}
+{{- with .vars.name }}
+  and name like replace({{ quote . }}, '*', '%')
+{{- end }}
+order by creation_date desc
+limit 1`,
+		Required: []string{"owner"},
+		Vars: map[string]interface{}{
+			"architecture": "x86_64",
+		},
+		VersionMapping: `let ami = this.after.index(0)
+root.image_id = $ami.image_id
+root.name = $ami.name
+root.creation_date = $ami.creation_date.string()
+root.architecture = $ami.architecture
+root.region = $ami.region`,
+	},
+
+	// aws_config_drift emits a new version whenever the configuration of any
+	// resource in the given table changes
+	"aws_config_drift": {
+		DigestField:  "digest",
+		DigestSource: digestSourceResults,
+		Plugins:      []string{"aws"},
+		Query: `select * from {{ .vars.table }}
+{{- with .vars.where }} where {{ . }}{{ end }}
+order by {{ .vars.key }}`,
+		Required: []string{"table"},
+		Vars: map[string]interface{}{
+			"key": "arn",
+		},
+		VersionMapping: `root.count = this.after.length().string()`,
+	},
+
+	// certificate_expiry emits a version listing the hosts whose certificates
+	// expire within the configured number of days
+	"certificate_expiry": {
+		Plugins: []string{"net"},
+		Query: `select domain, not_after
+from net_certificate
+where domain in ({{ quote .vars.hosts }})
+  and not_after < now() + make_interval(days => {{ .vars.days }})
+order by domain`,
+		Required: []string{"hosts"},
+		Vars: map[string]interface{}{
+			"days": 30,
+		},
+		VersionMapping: `let certs = this.after.sort_by(c -> c.not_after)
+root.hosts = $certs.map_each(c -> c.domain).sort().join(",")
+root.count = $certs.length().string()
+root.earliest_expiry = $certs.index(0).not_after.string()`,
+	},
+
+	// cost_anomaly emits a version when the previous day's spend deviates
+	// from the baseline carried by the previous version by more than the
+	// configured percentage, resetting the baseline
+	"cost_anomaly": {
+		Plugins: []string{"aws"},
+		Query: `select
+  sum(unblended_cost_amount)::numeric(20, 2)::text as spend,
+  (current_date - 1)::text as period,
+  {{ .vars.threshold }} as threshold
+from aws_cost_by_account_daily
+where period_start = current_date - 1`,
+		Vars: map[string]interface{}{
+			"threshold": 20,
+		},
+		VersionMapping: `let row = this.after.index(0)
+let spend = $row.spend.number().catch(0)
+let baseline = this.before.baseline.number().catch(null)
+let deviation = if $baseline == null {
+  0
+} else if $baseline == 0 {
+  if $spend == 0 { 0 } else { 100 }
+} else {
+  ($spend - $baseline) / $baseline * 100
+}
+root.baseline = $spend.string()
+root.period = $row.period
+root.deviation = $deviation.round().string()
+root = if $baseline != null && $deviation.abs() < $row.threshold { deleted() }`,
+	},
+
+	// iam_drift emits a version listing any IAM users, roles, and customer
+	// managed policies not matched by the allowlist file, where the same
+	// query is executed during get to write the unexpected principals
+	"iam_drift": {
+		GetQuery: true,
+		Plugins:  []string{"aws"},
+		Query: `with principals as (
+  select 'user' as type, arn from aws_iam_user
+  union all
+  select 'role' as type, arn from aws_iam_role
+  union all
+  select 'policy' as type, arn from aws_iam_policy where not is_aws_managed
+)
+select type, arn
+from principals
+where not arn like any (
+  select replace(pattern, '*', '%')
+  from unnest(array[{{ quote (lines (file .vars.allowlist)) }}]::text[]) as pattern
+)
+order by arn`,
+		Vars: map[string]interface{}{
+			"allowlist": "iam-allowlist.txt",
+		},
+		VersionMapping: `root.unexpected = this.after.map_each(p -> p.type + ":" + p.arn).join(",")
+root.count = this.after.length().string()`,
+	},
+
+	// github_release emits the latest release of a repository, ordered by
+	// semantic version (default) or publish date, including asset metadata
+	"github_release": {
+		Plugins: []string{"github"},
+		Query: `select
+  tag_name,
+  name,
+  published_at,
+  html_url,
+  assets,
+  {{ quote .vars.order }} as ordering
+from github_release
+where repository_full_name = {{ quote .vars.repository }}
+  and not draft
+{{- if not .vars.prerelease }} and not prerelease{{ end }}
+order by published_at desc
+limit {{ .vars.limit }}`,
+		Required: []string{"repository"},
+		Vars: map[string]interface{}{
+			"limit":      100,
+			"order":      "semver",
+			"prerelease": false,
+		},
+		VersionMapping: `let releases = if this.after.index(0).ordering == "published" {
+  this.after.sort_by(r -> r.published_at)
+} else {
+  this.after.sort(item -> item.left.tag_name.semver_compare(item.right.tag_name) < 0)
+}
+let release = $releases.index(-1)
+let assets = $release.assets.or([])
+root.tag = $release.tag_name
+root.name = $release.name.or("")
+root.published_at = $release.published_at.string()
+root.url = $release.html_url
+root.assets = $assets.map_each(a -> a.name).join(",")
+root.asset_count = $assets.length().string()`,
+	},
+}
+
+// applyPreset populates any unset source fields from the configured preset,
+// merging user vars over the preset defaults
+func (s *Source) applyPreset() error {
+	if s.Preset == "" {
+		return nil
+	}
+	p, ok := presets[s.Preset]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("invalid preset '%s', expected one of: %s", s.Preset, strings.Join(names, ", "))
+	}
+
+	if s.Query == "" {
+		s.Query, s.QueryTemplate = p.Query, true
+		if p.GetQuery {
+			s.getQuery = p.Query
+		}
+	}
+	if s.Mapping == nil && s.VersionMapping == "" && s.VersionMappingFile == "" {
+		s.VersionMapping = p.VersionMapping
+	}
+	if s.DigestField == "" {
+		s.DigestField = p.DigestField
+	}
+	if s.DigestSource == "" {
+		s.DigestSource = p.DigestSource
+	}
+
+	// add any preset plugins not already configured
+	for _, plugin := range p.Plugins {
+		found := false
+		for _, existing := range s.Plugins {
+			if pluginName(existing) == pluginName(plugin) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.Plugins = append(s.Plugins, plugin)
+		}
+	}
+
+	// merge user vars over preset defaults
+	vars := make(map[string]interface{}, len(p.Vars)+len(s.Vars))
+	for k, v := range p.Vars {
+		vars[k] = v
+	}
+	for k, v := range s.Vars {
+		vars[k] = v
+	}
+	for _, k := range p.Required {
+		if vars[k] == nil || vars[k] == "" {
+			return fmt.Errorf("preset '%s' requires vars.%s", s.Preset, k)
+		}
+	}
+	s.Vars = vars
+	return nil
+}
+
+// pluginName returns the fully qualified name of a plugin without any version,
+// e.g. aws@0.30 -> turbot/aws
+func pluginName(plugin string) string {
+	name, _, _ := strings.Cut(plugin, "@")
+	if !strings.Contains(name, "/") {
+		name = "turbot/" + name
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// defaultParallelism defines the default number of concurrent queries
+const defaultParallelism = 4
+
+// executeQueries executes all configured named queries concurrently, bounded
+// by the configured parallelism, and returns the results keyed by query name
+func (r *Resource) executeQueries(ctx context.Context, s *Source, v *Version) (interface{}, error) {
+	// render all queries prior to executing any
+	names := make([]string, 0, len(s.Queries))
+	queries := make(map[string]string, len(s.Queries))
+	for name, text := range s.Queries {
+		q, err := parseQuery(s, name, text)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing query '%s' template: %v", name, err)
+		}
+		query, err := q.render(templateData(s, v))
+		if err != nil {
+			return nil, fmt.Errorf("error rendering query '%s' template: %v", name, err)
+		}
+		names, queries[name] = append(names, name), query
+	}
+	sort.Strings(names)
+
+	results := make([]interface{}, len(names))
+	err := forEach(s.Parallelism, len(names), func(i int) error {
+		if s.Debug {
+			color.Yellow("executing query: %s", names[i])
+		}
+		out, err := r.query(ctx, s, queries[names[i]])
+		if err != nil {
+			return fmt.Errorf("error executing query '%s': %v", names[i], err)
+		}
+		results[i] = gjson.ParseBytes(out).Value()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	aggregated := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		aggregated[name] = results[i]
+	}
+	return aggregated, nil
+}
+
+// forEach invokes fn for each index in [0, n) concurrently, bounded by the
+// given parallelism, and returns the error of the lowest failed index
+func forEach(parallelism, n int, fn func(i int) error) error {
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	var wg sync.WaitGroup
+	sem, errs := make(chan struct{}, parallelism), make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+// staticArchive implements an archive with fixed history
+type staticArchive [][]byte
+
+func (a staticArchive) Close(context.Context) error {
+	return nil
+}
+
+func (a staticArchive) History(context.Context, []byte) ([][]byte, error) {
+	return a, nil
+}
+
+func (a staticArchive) Put(context.Context, ...[]byte) error {
+	return nil
+}
+
+func TestQuiet(t *testing.T) {
+	var buf bytes.Buffer
+	output := color.Output
+	color.Output = &buf
+	defer func() { color.Output = output }()
+
+	ctx := context.Background()
+	rows := []byte(`[{"id": "sensitive-row"}]`)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "after.json"), rows, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Source{
+		Debug:   true,
+		Mapping: &Mapping{Source: "root = this.after.index(0)"},
+		Quiet:   true,
+		Signing: &Signing{AllowUnsigned: true},
+	}
+
+	echo(s, rows)
+
+	_, meta, err := (&Resource{}).testMapping(ctx, s, dir, &MappingTest{After: "after.json"})
+	if err != nil {
+		t.Fatalf("unexpected mapping test error: %v", err)
+	}
+	if len(meta) != 0 {
+		t.Fatalf("expected no mapping result metadata, got %v", meta)
+	}
+
+	a := &signedArchive{Archive: staticArchive{[]byte(`{"id": "sensitive-row"}`)}, s: s}
+	if _, err := a.History(ctx, nil); err != nil {
+		t.Fatalf("unexpected history error: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "sensitive-row") {
+		t.Fatalf("expected no row data to be printed, got:\n%s", buf.String())
+	}
+}
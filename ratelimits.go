@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// renderRateLimits renders the configured rate limits as steampipe plugin
+// limiter blocks, grouped by plugin
+func renderRateLimits(limits []RateLimit) string {
+	plugins := make(map[string][]RateLimit)
+	var names []string
+	for _, l := range limits {
+		if _, ok := plugins[l.Plugin]; !ok {
+			names = append(names, l.Plugin)
+		}
+		plugins[l.Plugin] = append(plugins[l.Plugin], l)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "plugin %s {\n", strconv.Quote(name))
+		for _, l := range plugins[name] {
+			fmt.Fprintf(&b, "  limiter %s {\n", strconv.Quote(l.Name))
+			if l.MaxConcurrency > 0 {
+				fmt.Fprintf(&b, "    max_concurrency = %d\n", l.MaxConcurrency)
+			}
+			if l.BucketSize > 0 {
+				fmt.Fprintf(&b, "    bucket_size     = %d\n", l.BucketSize)
+			}
+			if l.FillRate > 0 {
+				fmt.Fprintf(&b, "    fill_rate       = %s\n", strconv.FormatFloat(l.FillRate, 'f', -1, 64))
+			}
+			if len(l.Scope) > 0 {
+				scope := make([]string, len(l.Scope))
+				for i, s := range l.Scope {
+					scope[i] = strconv.Quote(s)
+				}
+				fmt.Fprintf(&b, "    scope           = [%s]\n", strings.Join(scope, ", "))
+			}
+			if where := l.where(); where != "" {
+				fmt.Fprintf(&b, "    where           = %s\n", strconv.Quote(where))
+			}
+			b.WriteString("  }\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// where returns the limiter where clause, restricted to the configured
+// connection if specified
+func (l RateLimit) where() string {
+	if l.Connection == "" {
+		return l.Where
+	}
+	clause := fmt.Sprintf("connection = '%s'", strings.ReplaceAll(l.Connection, "'", "''"))
+	if l.Where != "" {
+		clause = fmt.Sprintf("%s and (%s)", clause, l.Where)
+	}
+	return clause
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestRenderRateLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		limits []RateLimit
+		want   string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "grouped by plugin",
+			limits: []RateLimit{
+				{Name: "s3", Plugin: "aws", MaxConcurrency: 10, Scope: []string{"connection", "region"}},
+				{Name: "default", Plugin: "github", BucketSize: 100, FillRate: 2.5},
+				{Name: "ec2", Plugin: "aws", BucketSize: 50, FillRate: 10, Where: "service = 'ec2'"},
+			},
+			want: `plugin "aws" {
+  limiter "s3" {
+    max_concurrency = 10
+    scope           = ["connection", "region"]
+  }
+  limiter "ec2" {
+    bucket_size     = 50
+    fill_rate       = 10
+    where           = "service = 'ec2'"
+  }
+}
+plugin "github" {
+  limiter "default" {
+    bucket_size     = 100
+    fill_rate       = 2.5
+  }
+}
+`,
+		},
+		{
+			name: "connection",
+			limits: []RateLimit{
+				{Name: "prod", Plugin: "aws", MaxConcurrency: 5, Connection: "aws_prod"},
+				{Name: "staging", Plugin: "aws", MaxConcurrency: 5, Connection: "aws_o'staging", Where: `service = "s3"`},
+			},
+			want: `plugin "aws" {
+  limiter "prod" {
+    max_concurrency = 5
+    where           = "connection = 'aws_prod'"
+  }
+  limiter "staging" {
+    max_concurrency = 5
+    where           = "connection = 'aws_o''staging' and (service = \"s3\")"
+  }
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := renderRateLimits(c.limits); got != c.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", c.want, got)
+			}
+		})
+	}
+}
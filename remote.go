@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+const (
+	// remoteFileAttempts defines the maximum number of attempts to download a
+	// remote file
+	remoteFileAttempts = 3
+
+	// remoteFileTimeout defines the maximum duration of a single remote file
+	// download attempt
+	remoteFileTimeout = 2 * time.Minute
+)
+
+// remote returns whether the file content is downloaded rather than inlined
+// via files
+func (o FileOptions) remote() bool {
+	return o.URL != "" || o.S3 != nil || o.GCS != nil
+}
+
+// hasRemoteFiles returns whether any files are downloaded from remote
+// sources
+func hasRemoteFiles(s *Source) bool {
+	for _, o := range s.FileOptions {
+		if o.remote() {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchFiles downloads all remote files to their destinations, retrying
+// failed downloads and verifying checksums if configured
+func (r *Resource) fetchFiles(ctx context.Context, s *Source) error {
+	for name, o := range s.FileOptions {
+		if !o.remote() {
+			continue
+		}
+		if _, ok := s.Files[name]; ok {
+			return fmt.Errorf("file '%s' must not define both inline content and a remote source", name)
+		}
+
+		f, err := resolveFile(s, name)
+		if err != nil {
+			return err
+		}
+		mode, err := fileMode(s, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(path.Dir(f), 0755); err != nil {
+			return fmt.Errorf("error creating file parent directory '%s': %v", path.Dir(f), err)
+		}
+
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			err = fetchFile(ctx, s, o, f, mode)
+			if err == nil || attempt >= remoteFileAttempts || ctx.Err() != nil {
+				break
+			}
+			color.Red("error downloading file '%s' (attempt %d of %d): %v", name, attempt, remoteFileAttempts, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * 2 * time.Second):
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error downloading file '%s': %v", name, err)
+		}
+		if err := chownFile(s, name, f); err != nil {
+			return err
+		}
+		if s.Debug {
+			color.Yellow("downloaded remote file in %s: %s", time.Since(start), f)
+		}
+	}
+	return nil
+}
+
+// fetchFile downloads a single remote file to a temporary file alongside the
+// destination, which replaces the destination once its size and checksum are
+// verified
+func fetchFile(ctx context.Context, s *Source, o FileOptions, f string, mode os.FileMode) error {
+	ctx, cancel := context.WithTimeout(ctx, remoteFileTimeout)
+	defer cancel()
+
+	body, err := openRemote(ctx, s, o)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	max := maxFileBytes(s)
+	tmp := f + ".download"
+	defer os.Remove(tmp)
+
+	h := sha256.New()
+	counter := &countingReader{r: io.LimitReader(body, int64(max)+1)}
+	if err := writeFile(tmp, io.TeeReader(counter, h), mode); err != nil {
+		return err
+	}
+	if counter.n > int64(max) {
+		return fmt.Errorf("exceeds maximum size of %d bytes", max)
+	}
+	if o.SHA256 != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, o.SHA256) {
+			return fmt.Errorf("checksum mismatch: expected %s, got %s", o.SHA256, sum)
+		}
+	}
+
+	// extract verified tarballs into the destination directory
+	if o.Extract {
+		return extractFile(s, tmp, f, o)
+	}
+	return os.Rename(tmp, f)
+}
+
+// extractFile extracts a downloaded tarball into the destination directory
+func extractFile(s *Source, tmp, dir string, o FileOptions) error {
+	archive, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	mode, err := o.extractMode()
+	if err != nil {
+		return err
+	}
+	return extractTarball(archive, dir, maxFileBytes(s), mode, s.Debug)
+}
+
+// openRemote opens the content of a remote file
+func openRemote(ctx context.Context, s *Source, o FileOptions) (io.ReadCloser, error) {
+	switch {
+	case o.S3 != nil:
+		store, err := blob.New(ctx, &o.S3.Config, s.Debug)
+		if err != nil {
+			return nil, err
+		}
+		return store.Open(ctx, o.S3.Key, o.S3.Version)
+	case o.GCS != nil:
+		return openGCS(ctx, o.GCS.Bucket, o.GCS.Object, o.GCS.Generation, o.GCS.AccessToken)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %d", res.StatusCode)
+	}
+	return res.Body, nil
+}
+
+// openGCS opens an object from gcs via the json api, authenticating with the
+// given access token if provided
+func openGCS(ctx context.Context, bucket, object, generation, token string) (io.ReadCloser, error) {
+	q := url.Values{"alt": []string{"media"}}
+	if generation != "" {
+		q.Set("generation", generation)
+	}
+	u := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?%s", url.PathEscape(bucket), url.PathEscape(object), q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %d", res.StatusCode)
+	}
+	return res.Body, nil
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// resolvedStatus defines the status field value of resolution versions
+const resolvedStatus = "resolved"
+
+// resolution returns a synthetic resolution version when emit_resolution is
+// enabled and the previous version was not itself a resolution, so that a
+// query that stops returning results emits exactly one resolution version
+func resolution(s *Source, v *Version) map[string]interface{} {
+	if !s.EmitResolution || v == nil || v.Data["status"] == resolvedStatus {
+		return nil
+	}
+	data := map[string]interface{}{
+		"status":      resolvedStatus,
+		"resolved_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	if s.target != "" {
+		data["target"] = s.target
+	}
+	return data
+}
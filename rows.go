@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/tidwall/gjson"
+)
+
+// SortKey describes a field by which result rows are ordered
+type SortKey struct {
+	Direction string `json:"direction" validate:"omitempty,oneof=asc desc"`
+	Field     string `json:"field" validate:"required"`
+}
+
+// shapeRows aggregates, sorts, and samples result rows, in that order, prior
+// to mapping or first row selection
+func shapeRows(s *Source, rows []interface{}) (_ []interface{}, err error) {
+	if s.Aggregate != nil {
+		if rows, err = aggregateRows(s, rows); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Sort) > 0 {
+		if rows, err = sortRows(s, rows); err != nil {
+			return nil, err
+		}
+	}
+	if s.Sample != nil {
+		if rows, err = sampleRows(s, rows); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// sortRows stably orders rows by the configured sort keys, where values of
+// different types are ordered null (or missing), false, number, string, true,
+// then objects and arrays
+func sortRows(s *Source, rows []interface{}) ([]interface{}, error) {
+	parsed := make([]gjson.Result, len(rows))
+	for i, row := range rows {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing row for sorting: %v", err)
+		}
+		parsed[i] = gjson.ParseBytes(b)
+	}
+
+	idx := make([]int, len(rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := parsed[idx[i]], parsed[idx[j]]
+		for _, key := range s.Sort {
+			x, y := a.Get(key.Field), b.Get(key.Field)
+			if key.Direction == "desc" {
+				x, y = y, x
+			}
+			if x.Less(y, true) {
+				return true
+			}
+			if y.Less(x, true) {
+				return false
+			}
+		}
+		return false
+	})
+
+	sorted := make([]interface{}, len(rows))
+	for i, j := range idx {
+		sorted[i] = rows[j]
+	}
+	return sorted, nil
+}
+
+// selectColumns projects the configured columns of a result row into
+// version keys, where columns may be specified as gjson paths (e.g.
+// tags.owner), failing if a column is missing from the row unless a null
+// policy is configured, in which case missing columns are treated as null
+func selectColumns(s *Source, row gjson.Result) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(s.Select))
+	for key, col := range s.Select {
+		v := row.Get(col)
+		if !v.Exists() && s.NullPolicy == "" {
+			return nil, fmt.Errorf("error selecting version key '%s': column '%s' not found in result", key, col)
+		}
+		data[key] = v.Value()
+	}
+	return data, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// supported sampling strategies
+const (
+	sampleFirst  = "first"
+	sampleHash   = "hash"
+	sampleRandom = "random"
+)
+
+// Sample describes how query results are bounded prior to mapping
+type Sample struct {
+	MaxRows  int    `json:"max_rows" validate:"required,gt=0"`
+	Strategy string `json:"strategy" validate:"omitempty,oneof=first random hash"`
+}
+
+// sampleRows returns at most max_rows of the given rows using the configured
+// strategy, where first retains the leading rows, random selects rows at
+// random in their original order, and hash selects the rows with the lowest
+// content hashes in hash order, which is stable regardless of query order
+func sampleRows(s *Source, rows []interface{}) ([]interface{}, error) {
+	n := s.Sample.MaxRows
+	if len(rows) <= n {
+		return rows, nil
+	}
+
+	strategy := s.Sample.Strategy
+	if strategy == "" {
+		strategy = sampleFirst
+	}
+
+	var sampled []interface{}
+	switch strategy {
+	case sampleFirst:
+		sampled = rows[:n]
+	case sampleRandom:
+		idx := rand.New(rand.NewSource(time.Now().UnixNano())).Perm(len(rows))[:n]
+		sort.Ints(idx)
+		sampled = make([]interface{}, 0, n)
+		for _, i := range idx {
+			sampled = append(sampled, rows[i])
+		}
+	case sampleHash:
+		type hashed struct {
+			sum string
+			row interface{}
+		}
+		hashes := make([]hashed, 0, len(rows))
+		for _, row := range rows {
+			b, err := json.Marshal(row)
+			if err != nil {
+				return nil, fmt.Errorf("error serializing row for sampling: %v", err)
+			}
+			hashes = append(hashes, hashed{sum: fmt.Sprintf("%x", sha256.Sum256(b)), row: row})
+		}
+		sort.SliceStable(hashes, func(i, j int) bool {
+			return hashes[i].sum < hashes[j].sum
+		})
+		sampled = make([]interface{}, 0, n)
+		for _, h := range hashes[:n] {
+			sampled = append(sampled, h.row)
+		}
+	}
+
+	color.Yellow("sampled %d of %d rows using strategy '%s'...", n, len(rows), strategy)
+	return sampled, nil
+}
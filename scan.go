@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// lastScanKey defines the snapshot store key of the last scan timestamp
+const lastScanKey = "last-scan"
+
+// scanDue returns true if the configured scan interval has elapsed since the
+// last recorded scan, or if no scan interval is configured
+func (r *Resource) scanDue(ctx context.Context, s *Source) (bool, error) {
+	if s.ScanInterval == "" {
+		return true, nil
+	}
+	interval, err := time.ParseDuration(s.ScanInterval)
+	if err != nil {
+		return false, fmt.Errorf("invalid scan_interval: %v", err)
+	}
+
+	obj, err := r.snapshots.Get(ctx, lastScanKey)
+	if err != nil {
+		return false, fmt.Errorf("error retrieving last scan: %v", err)
+	}
+	if obj == nil {
+		return true, nil
+	}
+	last, err := time.Parse(time.RFC3339, string(obj.Body))
+	if err != nil {
+		color.Yellow("ignoring invalid last scan timestamp: %v", err)
+		return true, nil
+	}
+
+	if elapsed := time.Since(last); elapsed < interval {
+		if s.Debug {
+			color.Yellow("last scan %s ago, next scan in %s", elapsed.Round(time.Second), (interval - elapsed).Round(time.Second))
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// recordScan records the time of a completed scan
+func (r *Resource) recordScan(ctx context.Context, s *Source, at time.Time) error {
+	if s.ScanInterval == "" {
+		return nil
+	}
+	if err := r.snapshots.Put(ctx, lastScanKey, []byte(at.UTC().Format(time.RFC3339))); err != nil {
+		return fmt.Errorf("error recording last scan: %v", err)
+	}
+	return nil
+}
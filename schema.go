@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// validateResults validates the parsed query results against the configured
+// result schema
+func validateResults(s *Source, results interface{}) error {
+	if s.ResultSchema == nil {
+		return nil
+	}
+	return validateSchema("result_schema", s.ResultSchema, results)
+}
+
+// validateVersion validates version data against the configured version
+// schema
+func validateVersion(s *Source, data map[string]interface{}) error {
+	if s.VersionSchema == nil || data == nil {
+		return nil
+	}
+	return validateSchema("version_schema", s.VersionSchema, data)
+}
+
+// validateSchema validates the given document against a JSON Schema,
+// returning an error describing every violation
+func validateSchema(name string, schema, doc interface{}) error {
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schema), gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return fmt.Errorf("error validating against %s: %v", name, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	violations := make([]string, len(result.Errors()))
+	for i, e := range result.Errors() {
+		violations[i] = e.String()
+	}
+	return fmt.Errorf("%s validation failed: %s", name, strings.Join(violations, "; "))
+}
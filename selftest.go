@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// errSkipped indicates that a selftest check does not apply to the
+// configured resource
+var errSkipped = errors.New("skipped")
+
+// selftests defines the checks executed by a selftest put step, in order
+var selftests = []struct {
+	name string
+	run  func(r *Resource, ctx context.Context, s *Source) error
+}{
+	{"archive", (*Resource).selftestArchive},
+	{"plugins", (*Resource).selftestPlugins},
+	{"query", (*Resource).selftestQuery},
+}
+
+// selftest validates archive connectivity, plugin availability, and query
+// execution in place of executing the configured query, recording the result
+// of each check as metadata and failing if any check fails
+func (r *Resource) selftest(ctx context.Context, s *Source) (Version, []sdk.Metadata, error) {
+	start := time.Now()
+	var meta []sdk.Metadata
+	var failed []string
+	for _, t := range selftests {
+		tstart := time.Now()
+		err := t.run(r, ctx, s)
+		elapsed := time.Since(tstart).Round(time.Millisecond)
+
+		var result string
+		switch {
+		case err == nil:
+			result = fmt.Sprintf("ok (%s)", elapsed)
+			color.Yellow("selftest %s: %s", t.name, result)
+		case err == errSkipped:
+			result = "skipped"
+			color.Yellow("selftest %s: %s", t.name, result)
+		default:
+			failed = append(failed, t.name)
+			result = fmt.Sprintf("failed: %v", err)
+			color.Red("selftest %s: %s", t.name, result)
+		}
+		meta = append(meta, sdk.Metadata{Name: t.name, Value: result})
+	}
+	if len(failed) > 0 {
+		return Version{}, meta, fmt.Errorf("selftest failed: %s", strings.Join(failed, ", "))
+	}
+
+	version := Version{map[string]interface{}{
+		"selftest":  "passed",
+		"tested_at": start.UTC().Format(time.RFC3339),
+	}}
+	return version, meta, nil
+}
+
+// selftestArchive writes, reads, and deletes a probe object alongside the
+// archive database
+func (r *Resource) selftestArchive(ctx context.Context, s *Source) error {
+	if s.Archive == nil || s.Archive.BoltDB == nil {
+		return errSkipped
+	}
+
+	store, err := archiveStore(ctx, s, "")
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf(".selftest-%d", time.Now().UnixNano())
+	probe := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := store.Put(ctx, key, probe); err != nil {
+		return err
+	}
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if obj == nil || !bytes.Equal(obj.Body, probe) {
+		return fmt.Errorf("probe object '%s' does not match written content", key)
+	}
+	return store.Delete(ctx, key)
+}
+
+// selftestPlugins verifies that steampipe can list installed plugins and
+// that each configured plugin and plugin bundle is installed
+func (r *Resource) selftestPlugins(ctx context.Context, s *Source) error {
+	if _, stderr, err := r.run(ctx, s, "plugin", "list"); err != nil {
+		return fmt.Errorf("error listing plugins: %v\n%s", err, string(stderr))
+	}
+
+	var missing []string
+	plugins := append([]string{}, s.Plugins...)
+	for _, b := range s.PluginBundles {
+		plugins = append(plugins, b.Plugin)
+	}
+	for _, plugin := range plugins {
+		ref := pluginRef(s, plugin)
+		if _, err := os.Stat(path.Join(installDir(s), "plugins", ref)); err != nil {
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("plugins not installed: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// selftestQuery executes a trivial query, bypassing the query result cache
+func (r *Resource) selftestQuery(ctx context.Context, s *Source) error {
+	stdout, stderr, err := r.run(ctx, s, "query", "--output=json", "select 1 as ok")
+	if err != nil {
+		return fmt.Errorf("error executing query: %v\n%s", err, string(stderr))
+	}
+	if !gjson.ValidBytes(stdout) {
+		echo(s, stdout)
+		return fmt.Errorf("invalid query output")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/benthosdev/benthos/v4/public/bloblang"
+)
+
+// semver describes a parsed semantic version
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+// parseSemver parses a semantic version with an optional v prefix, where
+// missing minor and patch components default to zero and build metadata is
+// ignored
+func parseSemver(s string) (v semver, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, hasPre := strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		if pre == "" {
+			return v, false
+		}
+		v.prerelease = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+// compareSemver compares two semantic versions, returning -1, 0, or 1, where
+// valid versions are ordered after invalid versions, which are compared
+// lexically
+func compareSemver(a, b string) int {
+	va, aok := parseSemver(a)
+	vb, bok := parseSemver(b)
+	switch {
+	case !aok && !bok:
+		return strings.Compare(a, b)
+	case !aok:
+		return -1
+	case !bok:
+		return 1
+	}
+
+	for i := range va.core {
+		if c := compareInt(va.core[i], vb.core[i]); c != 0 {
+			return c
+		}
+	}
+
+	// a version without a prerelease has higher precedence
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0
+	case len(va.prerelease) == 0:
+		return 1
+	case len(vb.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(va.prerelease), len(vb.prerelease))
+}
+
+// comparePrerelease compares prerelease identifiers, where numeric identifiers
+// are compared numerically and have lower precedence than alphanumeric ones
+func comparePrerelease(a, b string) int {
+	na, aerr := strconv.Atoi(a)
+	nb, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return compareInt(na, nb)
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareInt compares two integers, returning -1, 0, or 1
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// registerSemver registers the semver_compare method, which compares the
+// target version to another, returning -1, 0, or 1
+func registerSemver(env *bloblang.Environment) error {
+	spec := bloblang.NewPluginSpec().
+		Description("Compares the target semantic version to another, returning -1, 0, or 1.").
+		Param(bloblang.NewStringParam("other"))
+	return env.RegisterMethodV2("semver_compare", spec, func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		other, err := args.GetString("other")
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string value, got %T", v)
+			}
+			return int64(compareSemver(s, other)), nil
+		}, nil
+	})
+}
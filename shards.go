@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/tidwall/gjson"
+)
+
+// executeShards executes the configured query once per shard concurrently,
+// bounded by the configured parallelism, and returns the union of all rows
+// in shard order
+func (r *Resource) executeShards(ctx context.Context, s *Source, v *Version) ([]interface{}, error) {
+	rows, err := r.executeShardRows(ctx, s, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var union []interface{}
+	for _, r := range rows {
+		union = append(union, r...)
+	}
+	return union, nil
+}
+
+// deriveTargets executes the configured query once per shard and derives a
+// version from the rows of each shard, which records the shard as its target
+// field, where the previous version is provided to the mapping of its own
+// target only
+func (r *Resource) deriveTargets(ctx context.Context, s *Source, v *Version) ([]map[string]interface{}, error) {
+	mapping, err := r.loadMapping(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	rows, err := r.executeShardRows(ctx, s, v)
+	if err != nil {
+		return nil, err
+	}
+	r.track("query", start)
+
+	shards, _ := s.Shards.shards()
+	var derived []map[string]interface{}
+	for i, shard := range shards {
+		out, err := json.Marshal(rows[i])
+		if err != nil {
+			return nil, fmt.Errorf("error serializing result of target '%s': %v", shard, err)
+		}
+
+		var prev *Version
+		if v != nil && v.Data["target"] == shard {
+			prev = v
+		}
+		ts := *s
+		ts.target = shard
+		data, err := r.deriveResults(ctx, &ts, prev, mapping, out)
+		if err != nil {
+			return nil, fmt.Errorf("error deriving version of target '%s': %v", shard, err)
+		}
+		if data != nil {
+			derived = append(derived, data)
+		}
+	}
+	return derived, nil
+}
+
+// executeShardRows executes the configured query once per shard concurrently,
+// bounded by the configured parallelism, and returns the rows of each shard
+func (r *Resource) executeShardRows(ctx context.Context, s *Source, v *Version) ([][]interface{}, error) {
+	shards, useConnections := s.Shards.shards()
+
+	q, err := parseQuery(s, "query", s.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query template: %v", err)
+	}
+
+	rows := make([][]interface{}, len(shards))
+	err = forEach(s.Parallelism, len(shards), func(i int) error {
+		shard := shards[i]
+
+		// render query with the current shard
+		data := templateData(s, v)
+		data["shard"] = shard
+		query, err := q.render(data)
+		if err != nil {
+			return fmt.Errorf("error rendering query template for shard '%s': %v", shard, err)
+		}
+
+		// restrict connection shards via search path
+		var args []string
+		if useConnections {
+			args = append(args, "--search-path-prefix="+shard)
+		}
+
+		if s.Debug {
+			color.Yellow("executing query for shard: %s", shard)
+		}
+		out, err := r.query(ctx, s, query, args...)
+		if err != nil {
+			return fmt.Errorf("error executing query for shard '%s': %v", shard, err)
+		}
+
+		result := gjson.ParseBytes(out)
+		switch {
+		case result.IsArray():
+			rows[i] = result.Value().([]interface{})
+		case result.Type != gjson.Null:
+			rows[i] = []interface{}{result.Value()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// shards returns the configured shards, and whether they are connections
+func (s *Shards) shards() ([]string, bool) {
+	if len(s.Connections) > 0 {
+		return s.Connections, true
+	}
+	return s.Values, false
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+)
+
+type (
+	// Signing describes how archived versions are signed and verified
+	Signing struct {
+		AllowUnsigned bool            `json:"allow_unsigned"`
+		Keyless       *KeylessSigning `json:"keyless" validate:"omitempty"`
+		PrivateKey    string          `json:"private_key" validate:"required_without_all=Keyless PublicKey,excluded_with=Keyless"`
+		PublicKey     string          `json:"public_key" validate:"excluded_with=Keyless"`
+	}
+
+	// KeylessSigning describes the expected signer of cosign keyless
+	// signatures, which are created and verified via the cosign cli
+	KeylessSigning struct {
+		Identity string `json:"identity" validate:"required"`
+		Issuer   string `json:"issuer" validate:"required"`
+	}
+
+	// signedVersion describes an archived version along with its signature,
+	// or cosign bundle if signed keyless
+	signedVersion struct {
+		Bundle    json.RawMessage `json:"bundle,omitempty"`
+		Signature string          `json:"signature,omitempty"`
+		Version   json.RawMessage `json:"signed_version"`
+	}
+
+	// signedArchive signs versions prior to archival and verifies the
+	// signatures of archived versions prior to returning them
+	signedArchive struct {
+		sdk.Archive
+		s *Source
+	}
+)
+
+func (a *signedArchive) History(ctx context.Context, latest []byte) ([][]byte, error) {
+	items, err := a.Archive.History(ctx, latest)
+	if err != nil {
+		return nil, err
+	}
+	history := make([][]byte, 0, len(items))
+	for _, item := range items {
+		var sv signedVersion
+		if err := json.Unmarshal(item, &sv); err != nil || sv.Version == nil {
+			// unsigned versions could be written by anyone with access to the
+			// archive, so are only accepted when explicitly allowed
+			if !a.s.Signing.AllowUnsigned {
+				return nil, fmt.Errorf("archived version is not signed, set signing.allow_unsigned to accept versions archived before signing was enabled: %s", redact(a.s, item))
+			}
+			color.Yellow("warning: accepting unsigned archived version, which cannot be verified: %s", redact(a.s, item))
+			history = append(history, item)
+			continue
+		}
+		if err := verifySignature(ctx, a.s, &sv); err != nil {
+			return nil, fmt.Errorf("error verifying archived version signature: %v: %s", err, redact(a.s, sv.Version))
+		}
+		history = append(history, sv.Version)
+	}
+	return history, nil
+}
+
+func (a *signedArchive) Put(ctx context.Context, versions ...[]byte) error {
+	// skip versions that were previously signed, as keyless signatures are
+	// not deterministic and would otherwise be archived repeatedly
+	items, err := a.Archive.History(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving archive history: %v", err)
+	}
+	signed := make(map[string]bool, len(items))
+	for _, item := range items {
+		var sv signedVersion
+		if err := json.Unmarshal(item, &sv); err == nil && sv.Version != nil {
+			signed[string(sv.Version)] = true
+		}
+	}
+
+	var envelopes [][]byte
+	for _, v := range versions {
+		if signed[string(v)] {
+			continue
+		}
+		sv, err := sign(ctx, a.s, v)
+		if err != nil {
+			return fmt.Errorf("error signing version: %v", err)
+		}
+		b, err := json.Marshal(sv)
+		if err != nil {
+			return fmt.Errorf("error serializing signed version: %v", err)
+		}
+		envelopes = append(envelopes, b)
+	}
+	if len(envelopes) == 0 {
+		return nil
+	}
+	return a.Archive.Put(ctx, envelopes...)
+}
+
+// sign signs a serialized version with the configured private key, or
+// keyless via cosign
+func sign(ctx context.Context, s *Source, version []byte) (*signedVersion, error) {
+	if s.Signing.Keyless != nil {
+		bundle, err := cosignSign(ctx, s, version)
+		if err != nil {
+			return nil, err
+		}
+		return &signedVersion{Bundle: bundle, Version: version}, nil
+	}
+
+	if s.Signing.PrivateKey == "" {
+		return nil, fmt.Errorf("signing.private_key is required to archive versions")
+	}
+	key, err := parsePrivateKey(s.Signing.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	var sig []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, version)
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256(version)
+		if sig, err = ecdsa.SignASN1(rand.Reader, k, sum[:]); err != nil {
+			return nil, err
+		}
+	}
+	return &signedVersion{Signature: base64.StdEncoding.EncodeToString(sig), Version: version}, nil
+}
+
+// verifySignature verifies the signature of an archived version with the
+// configured public key, or keyless signer identity via cosign
+func verifySignature(ctx context.Context, s *Source, sv *signedVersion) error {
+	if s.Signing.Keyless != nil {
+		if sv.Bundle == nil {
+			return fmt.Errorf("missing cosign bundle")
+		}
+		return cosignVerify(ctx, s, sv)
+	}
+
+	if sv.Signature == "" {
+		return fmt.Errorf("missing signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(sv.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	key, err := publicKey(s)
+	if err != nil {
+		return err
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, sv.Version, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(sv.Version)
+		if !ecdsa.VerifyASN1(k, sum[:], sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	}
+	return nil
+}
+
+// parsePrivateKey parses a pem encoded pkcs8 ed25519 or ecdsa private key
+func parsePrivateKey(s string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("invalid signing.private_key: expected pem encoded key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing.private_key: %v", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("invalid signing.private_key: unsupported key type %T", key)
+	}
+}
+
+// publicKey returns the configured public key, or the public key of the
+// configured private key
+func publicKey(s *Source) (crypto.PublicKey, error) {
+	if s.Signing.PublicKey == "" {
+		key, err := parsePrivateKey(s.Signing.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public(), nil
+	}
+
+	block, _ := pem.Decode([]byte(s.Signing.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid signing.public_key: expected pem encoded key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing.public_key: %v", err)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid signing.public_key: unsupported key type %T", key)
+	}
+}
+
+// cosignSign signs a serialized version keyless via cosign, using the oidc
+// token if configured, and returns the resulting bundle
+func cosignSign(ctx context.Context, s *Source, version []byte) (json.RawMessage, error) {
+	dir, err := cosignDir(s)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	payload, bundle := path.Join(dir, "version.json"), path.Join(dir, "bundle.json")
+	if err := ioutil.WriteFile(payload, version, defaultFileMode); err != nil {
+		return nil, fmt.Errorf("error writing cosign payload: %v", err)
+	}
+	args := []string{"sign-blob", "--yes", "--bundle=" + bundle}
+	if s.OIDC != nil {
+		args = append(args, "--identity-token="+oidcTokenFile(s))
+	}
+	if err := cosign(ctx, s, append(args, payload)...); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cosign bundle: %v", err)
+	}
+	return json.RawMessage(bytes.TrimSpace(b)), nil
+}
+
+// cosignVerify verifies the cosign bundle of an archived version against the
+// expected signer identity and issuer
+func cosignVerify(ctx context.Context, s *Source, sv *signedVersion) error {
+	dir, err := cosignDir(s)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	payload, bundle := path.Join(dir, "version.json"), path.Join(dir, "bundle.json")
+	if err := ioutil.WriteFile(payload, sv.Version, defaultFileMode); err != nil {
+		return fmt.Errorf("error writing cosign payload: %v", err)
+	}
+	if err := ioutil.WriteFile(bundle, sv.Bundle, defaultFileMode); err != nil {
+		return fmt.Errorf("error writing cosign bundle: %v", err)
+	}
+	return cosign(ctx, s, "verify-blob",
+		"--bundle="+bundle,
+		"--certificate-identity="+s.Signing.Keyless.Identity,
+		"--certificate-oidc-issuer="+s.Signing.Keyless.Issuer,
+		payload,
+	)
+}
+
+// cosignDir creates a temporary directory for cosign payloads and bundles
+func cosignDir(s *Source) (string, error) {
+	if tmp := tmpDir(s); tmp != "" {
+		if err := os.MkdirAll(tmp, 0755); err != nil {
+			return "", fmt.Errorf("error creating temp directory: %v", err)
+		}
+	}
+	dir, err := ioutil.TempDir(tmpDir(s), "cosign")
+	if err != nil {
+		return "", fmt.Errorf("error creating cosign directory: %v", err)
+	}
+	return dir, nil
+}
+
+// cosign executes a cosign command
+func cosign(ctx context.Context, s *Source, args ...string) error {
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	if s.Debug {
+		color.Yellow(cmd.String())
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error executing cosign %s: %v: %s", args[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
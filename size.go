@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// supported oversize strategies
+const (
+	oversizeFail = "fail"
+	oversizeHash = "hash"
+)
+
+// fieldSize describes the serialized size of a single version field
+type fieldSize struct {
+	name string
+	size int
+}
+
+// enforceVersionSize verifies that the serialized version data does not exceed
+// the configured maximum size, either failing or replacing the largest values
+// with their hashes depending on the configured strategy
+func enforceVersionSize(s *Source, data map[string]interface{}) (map[string]interface{}, error) {
+	if s.MaxVersionSize <= 0 || data == nil {
+		return data, nil
+	}
+
+	size, err := versionSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if size <= s.MaxVersionSize {
+		return data, nil
+	}
+
+	// rank fields by serialized size, largest first
+	fields := make([]fieldSize, 0, len(data))
+	for k, v := range data {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing version field '%s': %v", k, err)
+		}
+		fields = append(fields, fieldSize{name: k, size: len(b)})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].size == fields[j].size {
+			return fields[i].name < fields[j].name
+		}
+		return fields[i].size > fields[j].size
+	})
+
+	if s.OversizeStrategy != oversizeHash {
+		largest := make([]string, 0, 3)
+		for i := 0; i < len(fields) && i < 3; i++ {
+			largest = append(largest, fmt.Sprintf("%s (%d bytes)", fields[i].name, fields[i].size))
+		}
+		return nil, fmt.Errorf("version size %d bytes exceeds max_version_size of %d bytes, largest fields: %s", size, s.MaxVersionSize, strings.Join(largest, ", "))
+	}
+
+	// replace the largest values with their hashes until the version fits
+	hashed := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		hashed[k] = v
+	}
+	for _, f := range fields {
+		sum, err := digest(hashed[f.name])
+		if err != nil {
+			return nil, err
+		}
+		hashed[f.name] = "sha256:" + sum
+		if s.Debug {
+			color.Yellow("replaced oversized version field with hash: %s", f.name)
+		}
+
+		if size, err = versionSize(hashed); err != nil {
+			return nil, err
+		} else if size <= s.MaxVersionSize {
+			return hashed, nil
+		}
+	}
+	return nil, fmt.Errorf("version size %d bytes exceeds max_version_size of %d bytes after hashing all fields", size, s.MaxVersionSize)
+}
+
+// versionSize returns the serialized size of the given version data
+func versionSize(data map[string]interface{}) (int, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, fmt.Errorf("error serializing version: %v", err)
+	}
+	return len(b), nil
+}
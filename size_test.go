@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnforceVersionSize(t *testing.T) {
+	data := map[string]interface{}{
+		"findings": strings.Repeat("x", 200),
+		"id":       "a",
+	}
+
+	cases := []struct {
+		name     string
+		max      int
+		strategy string
+		want     map[string]interface{}
+		err      string
+	}{
+		{
+			name: "disabled",
+			want: data,
+		},
+		{
+			name: "within limit",
+			max:  1000,
+			want: data,
+		},
+		{
+			name: "fail",
+			max:  100,
+			err:  "version size 224 bytes exceeds max_version_size of 100 bytes, largest fields: findings (202 bytes), id (3 bytes)",
+		},
+		{
+			name:     "explicit fail",
+			max:      100,
+			strategy: oversizeFail,
+			err:      "exceeds max_version_size of 100 bytes",
+		},
+		{
+			name:     "hash",
+			max:      100,
+			strategy: oversizeHash,
+			want: map[string]interface{}{
+				"findings": "sha256:9d9613fcb584b20b2112de8c1c205f035ea77c39c28d51b27949e7cc50029d7b",
+				"id":       "a",
+			},
+		},
+		{
+			name:     "hash exceeds limit",
+			max:      10,
+			strategy: oversizeHash,
+			err:      "exceeds max_version_size of 10 bytes after hashing all fields",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := enforceVersionSize(&Source{MaxVersionSize: c.max, OversizeStrategy: c.strategy}, data)
+			switch {
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected error containing '%s', got %v", c.err, err)
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !reflect.DeepEqual(got, c.want):
+				t.Fatalf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+
+	// the original version data is never modified
+	if data["findings"] != strings.Repeat("x", 200) {
+		t.Fatalf("expected version data to be unmodified")
+	}
+}
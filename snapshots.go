@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fatih/color"
+)
+
+// snapshotKey returns the snapshot object key for the given version data
+func snapshotKey(data map[string]interface{}) (string, error) {
+	sum, err := digest(data)
+	if err != nil {
+		return "", err
+	}
+	return sum + ".json", nil
+}
+
+// loadSnapshot retrieves the full query results archived alongside the given
+// version, returning nil if snapshots are not configured or not found
+func (r *Resource) loadSnapshot(ctx context.Context, v *Version) (interface{}, error) {
+	if r.snapshots == nil || v == nil {
+		return nil, nil
+	}
+
+	key, err := snapshotKey(v.Data)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := r.snapshots.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving snapshot: %v", err)
+	}
+	if obj == nil {
+		color.Yellow("no snapshot found for previous version...")
+		return nil, nil
+	}
+
+	var snapshot interface{}
+	if err := json.Unmarshal(obj.Body, &snapshot); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot: %v", err)
+	}
+	return snapshot, nil
+}
+
+// saveSnapshot archives the full query results alongside the given version
+func (r *Resource) saveSnapshot(ctx context.Context, data map[string]interface{}, results interface{}) error {
+	if r.snapshots == nil || data == nil {
+		return nil
+	}
+
+	key, err := snapshotKey(data)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("error serializing snapshot: %v", err)
+	}
+	if err := r.snapshots.Put(ctx, key, b); err != nil {
+		return fmt.Errorf("error archiving snapshot: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/fatih/color"
+)
+
+// homeDir returns the home directory used for steampipe commands, which is
+// either configured explicitly, derived from the current user if it contains a
+// steampipe installation, or the home directory of the image's steampipe user
+func homeDir(s *Source) string {
+	if s.Home != "" {
+		return s.Home
+	}
+	if s.WritableDir != "" {
+		return path.Join(s.WritableDir, "home")
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" && home != "/" {
+		if _, err := os.Stat(path.Join(home, ".steampipe")); err == nil {
+			return home
+		}
+	}
+	return defaultHome
+}
+
+// installDir returns the steampipe install directory, which contains plugins,
+// configuration, and database state
+func installDir(s *Source) string {
+	if dir := stateDir(s); dir != "" {
+		return dir
+	}
+	return path.Join(homeDir(s), ".steampipe")
+}
+
+// stateDir returns the directory that steampipe state is relocated to, which
+// is either the configured state directory or a subdirectory of the writable
+// directory, if any
+func stateDir(s *Source) string {
+	switch {
+	case s.StateDir != "":
+		return s.StateDir
+	case s.WritableDir != "":
+		return path.Join(s.WritableDir, "steampipe")
+	default:
+		return ""
+	}
+}
+
+// tmpDir returns the temporary directory used by steampipe commands when a
+// writable directory is configured
+func tmpDir(s *Source) string {
+	if s.WritableDir == "" {
+		return ""
+	}
+	return path.Join(s.WritableDir, "tmp")
+}
+
+// workDir returns the working directory used for steampipe commands and for
+// resolving relative file paths, defaulting to the current directory
+func workDir(s *Source) (string, error) {
+	switch {
+	case s.WorkDir != "":
+		return filepath.Abs(s.WorkDir)
+	case s.WritableDir != "":
+		return filepath.Abs(path.Join(s.WritableDir, "work"))
+	default:
+		return os.Getwd()
+	}
+}
+
+// initDirs creates the home, working, temporary, and configuration
+// directories if they do not exist
+func initDirs(s *Source) error {
+	dirs := []string{homeDir(s), configDir(s)}
+	if s.WorkDir != "" || s.WritableDir != "" {
+		wd, err := workDir(s)
+		if err != nil {
+			return fmt.Errorf("error resolving working directory: %v", err)
+		}
+		dirs = append(dirs, wd)
+	}
+	if tmp := tmpDir(s); tmp != "" {
+		dirs = append(dirs, tmp)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating directory '%s': %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// configDir returns the steampipe configuration directory
+func configDir(s *Source) string {
+	return path.Join(installDir(s), "config")
+}
+
+// varFile returns the path of the rendered mod variables file
+func varFile(s *Source) string {
+	return path.Join(installDir(s), "resource.spvars")
+}
+
+// initStateDir seeds the configured state directory with the contents of the
+// default install directory on first use, so that plugins and database state
+// persist across invocations in containers that retain the directory
+func initStateDir(s *Source) error {
+	dir := stateDir(s)
+	if dir == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(path.Join(dir, "plugins")); err == nil {
+		if s.Debug {
+			color.Yellow("using existing state directory: %s", dir)
+		}
+		return nil
+	}
+
+	color.Yellow("seeding state directory: %s", dir)
+	if err := copyDir(defaultInstallDir, dir); err != nil {
+		return fmt.Errorf("error seeding state directory '%s': %v", dir, err)
+	}
+	return os.MkdirAll(configDir(s), 0755)
+}
+
+// copyDir recursively copies the src directory to dst, preserving file modes
+// and symlinks
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(p, target, info.Mode().Perm())
+		default:
+			// skip sockets, pipes, and other special files
+			return nil
+		}
+	})
+}
+
+// copyFile copies a single regular file
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
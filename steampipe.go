@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/cache"
+	"github.com/tidwall/gjson"
+)
+
+// namedQuery matches references to named queries defined by mods, e.g.
+// aws_compliance.query.s3_bucket_public_read or query.my_query
+var namedQuery = regexp.MustCompile(`^([a-zA-Z0-9_-]+\.)?query\.[a-zA-Z0-9_-]+$`)
+
+// gracePeriod defines how long steampipe is given to exit after being
+// signalled before it is killed
+const gracePeriod = 10 * time.Second
+
+// prepare writes the steampipe configuration file and any supporting files
+// to the local filesystem
+func (r *Resource) prepare(s *Source) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.materialize(s)
+}
+
+// materialize writes the steampipe configuration file and any supporting
+// files, and must be called with r.mu held
+func (r *Resource) materialize(s *Source) error {
+	start := time.Now()
+
+	// seed persistent state directory if configured
+	if err := initStateDir(s); err != nil {
+		return err
+	}
+
+	// create required directories if missing
+	if err := initDirs(s); err != nil {
+		return err
+	}
+
+	// write steampipe config file
+	if err := writeFile(path.Join(configDir(s), "check.spc"), strings.NewReader(s.Config), defaultFileMode); err != nil {
+		return fmt.Errorf("error writing configuration: %v", err)
+	}
+
+	// write plugin rate limiter config
+	if len(s.RateLimits) > 0 {
+		limits := renderRateLimits(s.RateLimits)
+		if err := writeFile(path.Join(configDir(s), "rate_limits.spc"), strings.NewReader(limits), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing rate limit configuration: %v", err)
+		}
+		if s.Debug {
+			color.Yellow("wrote rate limit configuration:\n%s", limits)
+		}
+	}
+
+	// write shared aws config and credentials files
+	if len(s.AWSProfiles) > 0 {
+		if err := writeAWSProfiles(s); err != nil {
+			return err
+		}
+		if s.Debug {
+			config, _ := renderAWSProfiles(s.AWSProfiles)
+			color.Yellow("wrote aws config:\n%s", config)
+		}
+	}
+
+	// write azure credential files and connections
+	if s.Azure != nil {
+		if err := writeAzure(s); err != nil {
+			return err
+		}
+		if s.Debug && len(s.Azure.subscriptions()) > 0 {
+			color.Yellow("wrote azure connections:\n%s", renderAzureConnections(s))
+		}
+	}
+
+	// write gcp application default credentials and connections
+	if s.GCP != nil {
+		if err := writeGCP(s); err != nil {
+			return err
+		}
+		if s.Debug && len(s.GCP.Projects) > 0 {
+			color.Yellow("wrote gcp connections:\n%s", renderGCPConnections(s))
+		}
+	}
+
+	// write kubeconfigs and kubernetes connections
+	if len(s.Kubernetes) > 0 {
+		if err := writeKubernetes(s); err != nil {
+			return err
+		}
+		if s.Debug {
+			color.Yellow("wrote kubernetes connections:\n%s", renderKubernetesConnections(s))
+		}
+	}
+
+	// write terraform connection
+	if s.Terraform != nil {
+		conn := renderTerraform(s)
+		if err := writeFile(path.Join(configDir(s), "terraform.spc"), strings.NewReader(conn), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing terraform connection: %v", err)
+		}
+		if s.Debug {
+			color.Yellow("wrote terraform connection:\n%s", conn)
+		}
+	}
+
+	// write mod variables file
+	if len(s.Variables) > 0 {
+		vars, err := renderVariables(s.Variables)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(varFile(s), strings.NewReader(vars), defaultFileMode); err != nil {
+			return fmt.Errorf("error writing variables file: %v", err)
+		}
+		if s.Debug {
+			color.Yellow("wrote variables file:\n%s", vars)
+		}
+	}
+
+	r.track("config", start)
+
+	// write any supporting files
+	start = time.Now()
+	for name, o := range s.FileOptions {
+		if _, ok := s.Files[name]; !ok && !o.remote() {
+			return fmt.Errorf("file_options '%s' does not match any files", name)
+		}
+	}
+	for name, content := range s.Files {
+		// resolve and sandbox destination path
+		f, err := resolveFile(s, name)
+		if err != nil {
+			return err
+		}
+		mode, err := fileMode(s, name)
+		if err != nil {
+			return err
+		}
+
+		// create parent directories if not exist
+		dir := path.Dir(f)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("error creating file parent directory '%s': %v", dir, err)
+			}
+		}
+
+		// extract tarballs into the destination directory
+		body, n := fileContent(s, name, content)
+		if s.FileOptions[name].Extract {
+			mode, err := s.FileOptions[name].extractMode()
+			if err != nil {
+				return err
+			}
+			if err := extractTarball(body, f, maxFileBytes(s), mode, s.Debug); err != nil {
+				return fmt.Errorf("error extracting file '%s': %v", name, err)
+			}
+			if s.Debug {
+				color.Yellow("extracted custom archive: %s", f)
+			}
+			continue
+		}
+
+		// reject oversized files prior to writing
+		if n > maxFileBytes(s) {
+			return fmt.Errorf("file '%s' exceeds maximum size: %d > %d bytes", f, n, maxFileBytes(s))
+		}
+
+		// write file
+		if err := writeFile(f, body, mode); err != nil {
+			return fmt.Errorf("error writing file '%s': %v", f, err)
+		}
+		if err := chownFile(s, name, f); err != nil {
+			return err
+		}
+
+		if s.Debug {
+			color.Yellow("wrote custom file: %s", f)
+		}
+	}
+	r.track("files", start)
+	return nil
+}
+
+// connectionDigest returns a digest of the credential and connection inputs
+// beyond the steampipe configuration, such that cached query results are not
+// shared between sources that resolve to different accounts or credentials
+func connectionDigest(s *Source) (string, error) {
+	return digest(map[string]interface{}{
+		"aws_profiles": s.AWSProfiles,
+		"azure":        s.Azure,
+		"file_options": s.FileOptions,
+		"files":        s.Files,
+		"gcp":          s.GCP,
+		"kubernetes":   s.Kubernetes,
+		"oidc":         s.OIDC,
+		"terraform":    s.Terraform,
+		"variables":    s.Variables,
+	})
+}
+
+// query executes a single steampipe query with any additional command line
+// arguments and returns the raw json output
+func (r *Resource) query(ctx context.Context, s *Source, query string, args ...string) ([]byte, error) {
+	// resolve named queries defined by installed mods
+	if name := strings.TrimSpace(query); namedQuery.MatchString(name) {
+		query = name
+		if s.Debug {
+			color.Yellow("executing named query: %s", name)
+		}
+	}
+	args = append(args, modArgs(s)...)
+
+	// return cached result if available
+	var key string
+	if r.cache != nil {
+		conn, err := connectionDigest(s)
+		if err != nil {
+			return nil, err
+		}
+		key = cache.Key(s.Config, conn, query, strings.Join(args, " "))
+		if out, ok, err := r.cache.Get(ctx, key); err != nil {
+			color.Red("error retrieving cached query result: %v", err)
+		} else if ok {
+			color.Yellow("using cached query result...")
+			return out, nil
+		}
+	}
+
+	// execute steampipe query
+	stdout, stderr, err := r.run(ctx, s, append(append([]string{"query", "--output=json"}, args...), query)...)
+	echo(s, stdout)
+	if s := string(stderr); s != "" {
+		color.Red(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %v", err)
+	}
+	stdout = queryRows(stdout)
+
+	// cache query result
+	if r.cache != nil {
+		if err := r.cache.Put(ctx, key, stdout); err != nil {
+			color.Red("error caching query result: %v", err)
+		}
+	}
+	return stdout, nil
+}
+
+// queryRows returns the result rows of json query output, unwrapping the
+// {"columns": [...], "rows": [...]} envelope emitted by newer steampipe
+// versions, which older versions emit as a bare array of rows
+func queryRows(out []byte) []byte {
+	if result := gjson.ParseBytes(out); result.IsObject() {
+		if rows := result.Get("rows"); rows.Exists() {
+			return []byte(rows.Raw)
+		}
+	}
+	return out
+}
+
+// run executes a steampipe command, classifying any failure and retrying
+// failures of the configured retry classes
+func (r *Resource) run(ctx context.Context, s *Source, args ...string) ([]byte, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		stdout, stderr, err := r.runOnce(ctx, s, args...)
+		if err == nil {
+			return stdout, stderr, nil
+		}
+
+		class := classify(ctx, args, stderr, err)
+		if class == "" {
+			return stdout, stderr, err
+		}
+		cerr := &steampipeError{Class: class, ExitCode: exitCode(err), err: err}
+
+		retry, delay, rerr := s.Retry.next(class, attempt)
+		if rerr != nil {
+			return stdout, stderr, rerr
+		}
+		if !retry || ctx.Err() != nil {
+			r.fail(args, stderr, cerr, attempt)
+			return stdout, stderr, cerr
+		}
+
+		color.Yellow("retrying after %s in %s (attempt %d of %d)...", cerr, delay, attempt+2, s.Retry.Attempts+1)
+		select {
+		case <-ctx.Done():
+			r.fail(args, stderr, cerr, attempt)
+			return stdout, stderr, cerr
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runOnce executes a steampipe command in its own process group, forwarding
+// context cancellation to the process group and stopping any implicit
+// steampipe service left behind
+func (r *Resource) runOnce(ctx context.Context, s *Source, args ...string) ([]byte, []byte, error) {
+	wd, err := workDir(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error resolving working directory: %v", err)
+	}
+
+	// configure steampipe command
+	var outb, errb bytes.Buffer
+	cmd := exec.Command("steampipe", args...)
+	cmd.Env = r.env(s)
+	cmd.Dir = wd
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if logEnabled(s, "info") {
+		color.Yellow(cmd.String())
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	// forward cancellation to the steampipe process group, escalating to
+	// SIGKILL if the process group does not exit within the grace period
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			color.Yellow("received cancellation, terminating steampipe...")
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+			select {
+			case <-done:
+			case <-time.After(gracePeriod):
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	r.record(cmd.Args, errb.Bytes(), err)
+
+	if ctx.Err() != nil {
+		r.stopService(s)
+		return outb.Bytes(), errb.Bytes(), fmt.Errorf("cancelled: %v", ctx.Err())
+	}
+	return outb.Bytes(), errb.Bytes(), err
+}
+
+// stopService forcefully stops any steampipe service and database process
+// started implicitly by an interrupted command
+func (r *Resource) stopService(s *Source) {
+	cmd := exec.Command("steampipe", "service", "stop", "--force")
+	cmd.Env = r.env(s)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		color.Red("error stopping steampipe service: %v\n%s", err, string(out))
+	}
+}
+
+// modArgs returns the command line arguments used to configure the mod
+// workspace and variables
+func modArgs(s *Source) (args []string) {
+	if s.ModLocation != "" {
+		args = append(args, "--mod-location="+s.ModLocation)
+	}
+	if len(s.Variables) > 0 {
+		args = append(args, "--var-file="+varFile(s))
+	}
+	return args
+}
+
+// env returns the environment variables used for steampipe commands
+func (r *Resource) env(s *Source) []string {
+	envs := append(os.Environ(), "HOME="+homeDir(s))
+	if dir := stateDir(s); dir != "" {
+		envs = append(envs, "STEAMPIPE_INSTALL_DIR="+dir)
+	}
+	if tmp := tmpDir(s); tmp != "" {
+		envs = append(envs, "TMPDIR="+tmp)
+	}
+	if s.Azure != nil {
+		envs = append(envs, azureEnv(s)...)
+	}
+	if s.GCP != nil {
+		envs = append(envs, "GOOGLE_APPLICATION_CREDENTIALS="+gcpCredentialsFile(s))
+	}
+	if l := logLevel(s); l != "" {
+		envs = append(envs, "STEAMPIPE_LOG_LEVEL="+strings.ToUpper(l))
+	}
+	return envs
+}
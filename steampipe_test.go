@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestQueryRows(t *testing.T) {
+	cases := []struct {
+		name string
+		out  string
+		want string
+	}{
+		{
+			name: "array",
+			out:  `[{"id": "a"}]`,
+			want: `[{"id": "a"}]`,
+		},
+		{
+			name: "envelope",
+			out:  `{"columns": [{"name": "id", "data_type": "text"}], "rows": [{"id": "a"}]}`,
+			want: `[{"id": "a"}]`,
+		},
+		{
+			name: "empty envelope",
+			out:  `{"columns": [], "rows": []}`,
+			want: `[]`,
+		},
+		{
+			name: "object without rows",
+			out:  `{"id": "a"}`,
+			want: `{"id": "a"}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := string(queryRows([]byte(c.out))); got != c.want {
+				t.Fatalf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs defines the helper functions available to query templates
+var templateFuncs = template.FuncMap{
+	"json":  toJSON,
+	"lines": lines,
+	"quote": quoteSQL,
+}
+
+// parseTemplate parses a query template, where the file function reads the
+// named supporting file of the given source
+func parseTemplate(s *Source, name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Funcs(template.FuncMap{
+		"file": func(name string) (string, error) {
+			return readFile(s, name)
+		},
+	}).Parse(text)
+}
+
+// queryTemplate describes a query that is rendered as a template when
+// source.query_template is enabled, and otherwise executed verbatim
+type queryTemplate struct {
+	t    *template.Template
+	text string
+}
+
+// parseQuery parses the given query as a template if query templates are
+// enabled
+func parseQuery(s *Source, name, text string) (*queryTemplate, error) {
+	if !s.QueryTemplate {
+		return &queryTemplate{text: text}, nil
+	}
+	t, err := parseTemplate(s, name, text)
+	if err != nil {
+		return nil, err
+	}
+	return &queryTemplate{t: t}, nil
+}
+
+// render renders the query using the provided data, if parsed as a template
+func (q *queryTemplate) render(data map[string]interface{}) (string, error) {
+	if q.t == nil {
+		return q.text, nil
+	}
+	return renderTemplate(q.t, data)
+}
+
+// renderTemplate renders a parsed query template using the provided data
+func renderTemplate(t *template.Template, data map[string]interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderQuery renders the configured source query template
+func renderQuery(s *Source, v *Version) (string, error) {
+	q, err := parseQuery(s, "query", s.Query)
+	if err != nil {
+		return "", fmt.Errorf("error parsing query template: %v", err)
+	}
+	query, err := q.render(templateData(s, v))
+	if err != nil {
+		return "", fmt.Errorf("error rendering query template: %v", err)
+	}
+	return query, nil
+}
+
+// templateData returns the common data available to all query templates,
+// including concourse build metadata, source files and vars, and the previous
+// version
+func templateData(s *Source, v *Version) map[string]interface{} {
+	// limit environment variables to build metadata, excluding credentials
+	// provided to plugins via the environment
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok && (strings.HasPrefix(k, "BUILD_") || k == "ATC_EXTERNAL_URL") {
+			env[k] = v
+		}
+	}
+
+	var version map[string]interface{}
+	if v != nil {
+		version = v.Data
+	}
+
+	return map[string]interface{}{
+		"env":     env,
+		"files":   s.Files,
+		"vars":    s.Vars,
+		"version": version,
+	}
+}
+
+// readFile returns the content of the named supporting file as written to
+// disk, whether provided inline or downloaded via file_options, failing if
+// the file was not configured
+func readFile(s *Source, name string) (string, error) {
+	f, err := resolveFile(s, name)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(f)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("file '%s' not found, configure it via files or file_options", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading file '%s': %v", name, err)
+	}
+	return string(b), nil
+}
+
+// toJSON serializes the given value as a json string
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// lines splits the given text into a list of its non-empty lines, ignoring
+// surrounding whitespace and comment lines beginning with #
+func lines(text string) []interface{} {
+	items := []interface{}{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// quoteSQL renders the given value as a SQL literal, with lists rendered as a
+// comma separated list of literals suitable for use in an IN clause, where an
+// empty list renders as null, such that IN (null) matches no rows rather than
+// producing invalid SQL
+func quoteSQL(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return "'" + strings.ReplaceAll(x, "'", "''") + "'", nil
+	case bool, float64, int, int64:
+		return fmt.Sprint(x), nil
+	case []interface{}:
+		if len(x) == 0 {
+			return "null", nil
+		}
+		items := make([]string, len(x))
+		for i, item := range x {
+			quoted, err := quoteSQL(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = quoted
+		}
+		return strings.Join(items, ", "), nil
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return "", err
+		}
+		return quoteSQL(string(b))
+	}
+}
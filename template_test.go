@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestQuoteSQL(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "null", value: nil, want: "null"},
+		{name: "string", value: "us-east-1", want: "'us-east-1'"},
+		{name: "escaped quote", value: "o'brien", want: "'o''brien'"},
+		{name: "injection", value: "'; drop table users; --", want: "'''; drop table users; --'"},
+		{name: "backslash", value: `a\'b`, want: `'a\''b'`},
+		{name: "bool", value: true, want: "true"},
+		{name: "float", value: 1.5, want: "1.5"},
+		{name: "int", value: 42, want: "42"},
+		{name: "list", value: []interface{}{"a", "b'c", 1.0, nil}, want: "'a', 'b''c', 1, null"},
+		{name: "empty list", value: []interface{}{}, want: "null"},
+		{name: "object", value: map[string]interface{}{"name": "o'brien"}, want: `'{"name":"o''brien"}'`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := quoteSQL(c.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.want {
+				t.Fatalf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestQuoteSQLEmptyList(t *testing.T) {
+	tmpl, err := template.New("query").Funcs(templateFuncs).Parse(`select * from aws_iam_role where name in ({{ quote (lines .) }})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, "# no roles allowed\n"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "select * from aws_iam_role where name in (null)"; b.String() != want {
+		t.Fatalf("expected %s, got %s", want, b.String())
+	}
+}
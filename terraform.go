@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/concourse-steampipe-resource/internal/blob"
+)
+
+// terraformTimeout defines the maximum duration of a single remote state
+// download
+const terraformTimeout = 30 * time.Second
+
+type (
+	// Terraform describes a steampipe terraform connection whose remote state
+	// files are downloaded by the resource prior to executing queries
+	Terraform struct {
+		Connection         string           `json:"connection"`
+		ConfigurationPaths []string         `json:"configuration_paths"`
+		States             []TerraformState `json:"states" validate:"omitempty,dive"`
+	}
+
+	// TerraformState describes a terraform state backend and the workspaces to
+	// download from it
+	TerraformState struct {
+		Name       string             `json:"name" validate:"required"`
+		GCS        *TerraformGCSState `json:"gcs" validate:"required_without=S3,excluded_with=S3"`
+		S3         *TerraformS3State  `json:"s3" validate:"required_without=GCS"`
+		Workspaces []string           `json:"workspaces"`
+	}
+
+	// TerraformS3State describes a terraform s3 backend
+	TerraformS3State struct {
+		blob.Config
+		Key                string `json:"key" validate:"required"`
+		WorkspaceKeyPrefix string `json:"workspace_key_prefix"`
+	}
+
+	// TerraformGCSState describes a terraform gcs backend
+	TerraformGCSState struct {
+		AccessToken string `json:"access_token"`
+		Bucket      string `json:"bucket" validate:"required"`
+		Prefix      string `json:"prefix"`
+	}
+)
+
+// workspaces returns the configured state workspaces, defaulting to the
+// default workspace
+func (t TerraformState) workspaces() []string {
+	if len(t.Workspaces) == 0 {
+		return []string{"default"}
+	}
+	return t.Workspaces
+}
+
+// key returns the object key of the given workspace's state, following the
+// layout used by the terraform s3 and gcs backends
+func (t TerraformState) key(workspace string) string {
+	if t.S3 != nil {
+		if workspace == "default" {
+			return t.S3.Key
+		}
+		prefix := t.S3.WorkspaceKeyPrefix
+		if prefix == "" {
+			prefix = "env:"
+		}
+		return path.Join(prefix, workspace, t.S3.Key)
+	}
+	return path.Join(t.GCS.Prefix, workspace+".tfstate")
+}
+
+// terraformDir returns the directory that downloaded state files are
+// written to
+func terraformDir(s *Source) string {
+	return path.Join(homeDir(s), ".terraform-states")
+}
+
+// terraformStateFile returns the local path of a downloaded state file
+func terraformStateFile(s *Source, t TerraformState, workspace string) string {
+	return path.Join(terraformDir(s), t.Name, workspace+".tfstate")
+}
+
+// syncTerraform downloads the state of each configured workspace
+func (r *Resource) syncTerraform(ctx context.Context, s *Source) error {
+	for _, t := range s.Terraform.States {
+		if err := os.MkdirAll(path.Join(terraformDir(s), t.Name), 0700); err != nil {
+			return fmt.Errorf("error creating terraform state directory: %v", err)
+		}
+
+		var store *blob.Store
+		if t.S3 != nil {
+			var err error
+			if store, err = blob.New(ctx, &t.S3.Config, s.Debug); err != nil {
+				return fmt.Errorf("error initializing terraform state '%s' store: %v", t.Name, err)
+			}
+		}
+
+		for _, workspace := range t.workspaces() {
+			key := t.key(workspace)
+			var b []byte
+			if store != nil {
+				obj, err := store.Get(ctx, key)
+				if err != nil {
+					return fmt.Errorf("error downloading terraform state '%s' workspace '%s': %v", t.Name, workspace, err)
+				}
+				if obj == nil {
+					return fmt.Errorf("terraform state '%s' workspace '%s' not found: %s", t.Name, workspace, key)
+				}
+				b = obj.Body
+			} else {
+				var err error
+				if b, err = downloadGCS(ctx, t.GCS, key); err != nil {
+					return fmt.Errorf("error downloading terraform state '%s' workspace '%s': %v", t.Name, workspace, err)
+				}
+			}
+
+			f := terraformStateFile(s, t, workspace)
+			if err := ioutil.WriteFile(f, b, 0600); err != nil {
+				return fmt.Errorf("error writing terraform state '%s' workspace '%s': %v", t.Name, workspace, err)
+			}
+			if s.Debug {
+				color.Yellow("downloaded terraform state: %s", f)
+			}
+		}
+	}
+	return nil
+}
+
+// downloadGCS downloads an object from gcs via the json api, authenticating
+// with the configured access token if provided
+func downloadGCS(ctx context.Context, cfg *TerraformGCSState, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, terraformTimeout)
+	defer cancel()
+
+	body, err := openGCS(ctx, cfg.Bucket, key, "", cfg.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// renderTerraform renders the steampipe terraform connection, which reads
+// the configuration paths and all downloaded state files
+func renderTerraform(s *Source) string {
+	name := s.Terraform.Connection
+	if name == "" {
+		name = "terraform"
+	}
+
+	var states []string
+	for _, t := range s.Terraform.States {
+		for _, workspace := range t.workspaces() {
+			states = append(states, strconv.Quote(terraformStateFile(s, t, workspace)))
+		}
+	}
+	configs := make([]string, len(s.Terraform.ConfigurationPaths))
+	for i, p := range s.Terraform.ConfigurationPaths {
+		configs[i] = strconv.Quote(p)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "connection %s {\n", strconv.Quote(name))
+	b.WriteString("  plugin                   = \"terraform\"\n")
+	fmt.Fprintf(&b, "  configuration_file_paths = [%s]\n", strings.Join(configs, ", "))
+	fmt.Fprintf(&b, "  state_file_paths         = [%s]\n", strings.Join(states, ", "))
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	sdk "github.com/cludden/concourse-go-sdk"
+	"github.com/fatih/color"
+)
+
+// timings records the cumulative duration of each stage of an operation, in
+// the order each stage was first recorded
+type timings struct {
+	mu        sync.Mutex
+	stages    []string
+	durations map[string]time.Duration
+	counts    map[string]int
+}
+
+// track records the duration of a stage that began at the given time
+func (r *Resource) track(stage string, start time.Time) {
+	d := time.Since(start)
+
+	t := &r.timings
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.durations == nil {
+		t.durations, t.counts = make(map[string]time.Duration), make(map[string]int)
+	}
+	if _, ok := t.durations[stage]; !ok {
+		t.stages = append(t.stages, stage)
+	}
+	t.durations[stage] += d
+	t.counts[stage]++
+}
+
+// reportTimings logs a summary table of recorded stage durations when debug
+// logging is enabled
+func (r *Resource) reportTimings(s *Source) {
+	if !s.Debug {
+		return
+	}
+
+	t := &r.timings
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.stages) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "stage\tcount\tduration")
+	for _, stage := range t.stages {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", stage, t.counts[stage], t.durations[stage].Round(time.Millisecond))
+	}
+	w.Flush()
+	color.Yellow("stage timings:\n%s", buf.String())
+}
+
+// timedArchive records the duration of archive operations, reporting check
+// timings on close
+type timedArchive struct {
+	sdk.Archive
+	r *Resource
+}
+
+func (a *timedArchive) History(ctx context.Context, latest []byte) ([][]byte, error) {
+	defer a.r.track("archive", time.Now())
+	return a.Archive.History(ctx, latest)
+}
+
+func (a *timedArchive) Put(ctx context.Context, versions ...[]byte) error {
+	defer a.r.track("archive", time.Now())
+	return a.Archive.Put(ctx, versions...)
+}
+
+func (a *timedArchive) Close(ctx context.Context) error {
+	err := func() error {
+		defer a.r.track("archive", time.Now())
+		return a.Archive.Close(ctx)
+	}()
+	if a.r.checked != nil {
+		a.r.reportTimings(a.r.checked)
+	}
+	return err
+}
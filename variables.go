@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// variableName matches valid steampipe mod variable names
+var variableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// renderVariables renders the configured mod variables as a steampipe
+// variables file, where values are encoded as json which is valid hcl
+func renderVariables(vars map[string]interface{}) (string, error) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if !variableName.MatchString(name) {
+			return "", fmt.Errorf("invalid variable name '%s'", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value, err := json.Marshal(vars[name])
+		if err != nil {
+			return "", fmt.Errorf("error serializing variable '%s': %v", name, err)
+		}
+		fmt.Fprintf(&b, "%s = %s\n", name, value)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// verifyVersion confirms that the given version is verifiable, either by
+// locating it in the archive history or by re-deriving its digest
+func (r *Resource) verifyVersion(ctx context.Context, s *Source, v *Version) error {
+	switch {
+	case s.Archive != nil:
+		return r.verifyArchived(ctx, s, v)
+	case s.DigestField != "":
+		return r.verifyDigest(ctx, s, v)
+	default:
+		return fmt.Errorf("version verification requires source.archive or source.digest_field")
+	}
+}
+
+// verifyArchived confirms that the given version exists in the archive
+// history
+func (r *Resource) verifyArchived(ctx context.Context, s *Source, v *Version) error {
+	a, err := r.Archive(ctx, s)
+	if err != nil {
+		return fmt.Errorf("error initializing archive: %v", err)
+	}
+	defer a.Close(ctx)
+
+	history, err := a.History(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error retrieving archive history: %v", err)
+	}
+
+	// normalize the version through a json round trip prior to comparison
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error serializing version: %v", err)
+	}
+	var want Version
+	if err := json.Unmarshal(b, &want); err != nil {
+		return fmt.Errorf("error parsing version: %v", err)
+	}
+
+	for _, item := range history {
+		var got Version
+		if err := json.Unmarshal(item, &got); err != nil {
+			continue
+		}
+		if reflect.DeepEqual(got.Data, want.Data) {
+			return nil
+		}
+	}
+	return fmt.Errorf("version not found in archive history, which may have been pruned")
+}
+
+// verifyDigest confirms that the digest field of the given version matches
+// its re-derived digest, using the archived snapshot for results digests
+func (r *Resource) verifyDigest(ctx context.Context, s *Source, v *Version) error {
+	expected, ok := v.Data[s.DigestField].(string)
+	if !ok {
+		return fmt.Errorf("version is missing digest field '%s'", s.DigestField)
+	}
+
+	var input interface{}
+	if s.DigestSource == digestSourceResults {
+		snapshot, err := r.loadSnapshot(ctx, v)
+		if err != nil {
+			return err
+		}
+		if snapshot == nil {
+			return fmt.Errorf("unable to verify results digest: no snapshot found for version")
+		}
+		input = snapshot
+	} else {
+		data := make(map[string]interface{}, len(v.Data))
+		for k, val := range v.Data {
+			if k != s.DigestField {
+				data[k] = val
+			}
+		}
+		input = data
+	}
+
+	sum, err := digest(input)
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return fmt.Errorf("version digest mismatch: expected %s, got %s", expected, sum)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// steampipeDownloadTimeout defines the maximum duration of a steampipe binary
+// download from the configured mirror
+const steampipeDownloadTimeout = 5 * time.Minute
+
+// versionPattern matches the version reported by steampipe --version
+var versionPattern = regexp.MustCompile(`v?(\d+\.\d+\.\d+[0-9A-Za-z.+-]*)`)
+
+// constraintPattern matches a single version constraint, e.g. >= 0.20
+var constraintPattern = regexp.MustCompile(`^(=|!=|>=|<=|>|<|~>)?\s*(\S+)$`)
+
+// SteampipeMirror describes a location that a steampipe release archive is
+// downloaded from when the installed binary does not satisfy the configured
+// version constraint
+type SteampipeMirror struct {
+	URL     string            `json:"url" validate:"required,url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// verifySteampipe fails if the installed steampipe binary does not satisfy
+// the configured version constraint, first installing steampipe from the
+// configured mirror if available
+func (r *Resource) verifySteampipe(ctx context.Context, s *Source) error {
+	version, err := r.steampipeVersion(ctx, s)
+	if err != nil {
+		return err
+	}
+	ok, err := satisfies(version, s.SteampipeVersion)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if s.Debug {
+			color.Yellow("steampipe %s satisfies constraint: %s", version, s.SteampipeVersion)
+		}
+		return nil
+	}
+	if s.SteampipeMirror == nil {
+		return fmt.Errorf("steampipe %s does not satisfy steampipe_version constraint: %s", version, s.SteampipeVersion)
+	}
+
+	color.Yellow("steampipe %s does not satisfy constraint %s, installing from mirror...", version, s.SteampipeVersion)
+	if err := installSteampipe(ctx, s); err != nil {
+		return err
+	}
+	if version, err = r.steampipeVersion(ctx, s); err != nil {
+		return err
+	}
+	if ok, _ := satisfies(version, s.SteampipeVersion); !ok {
+		return fmt.Errorf("steampipe %s installed from mirror does not satisfy steampipe_version constraint: %s", version, s.SteampipeVersion)
+	}
+	return nil
+}
+
+// steampipeVersion returns the version of the installed steampipe binary
+func (r *Resource) steampipeVersion(ctx context.Context, s *Source) (string, error) {
+	stdout, stderr, err := r.run(ctx, s, "--version")
+	if err != nil {
+		return "", fmt.Errorf("error retrieving steampipe version: %v\n%s", err, string(stderr))
+	}
+	m := versionPattern.FindStringSubmatch(string(stdout))
+	if m == nil {
+		return "", fmt.Errorf("error parsing steampipe version: %s", strings.TrimSpace(string(stdout)))
+	}
+	return m[1], nil
+}
+
+// satisfies returns whether the version satisfies all comma separated
+// constraints, where each constraint is one of =, !=, >, >=, <, <=, or ~>
+// (allowing only the rightmost component to increase) followed by a version
+func satisfies(version, constraints string) (bool, error) {
+	if _, ok := parseSemver(version); !ok {
+		return false, fmt.Errorf("invalid steampipe version: %s", version)
+	}
+	for _, c := range strings.Split(constraints, ",") {
+		m := constraintPattern.FindStringSubmatch(strings.TrimSpace(c))
+		if m == nil {
+			return false, fmt.Errorf("invalid steampipe_version constraint: %s", c)
+		}
+		target, ok := parseSemver(m[2])
+		if !ok {
+			return false, fmt.Errorf("invalid steampipe_version constraint: %s", c)
+		}
+
+		cmp := compareSemver(version, m[2])
+		var match bool
+		switch m[1] {
+		case "", "=":
+			match = cmp == 0
+		case "!=":
+			match = cmp != 0
+		case ">":
+			match = cmp > 0
+		case ">=":
+			match = cmp >= 0
+		case "<":
+			match = cmp < 0
+		case "<=":
+			match = cmp <= 0
+		case "~>":
+			// e.g. ~> 0.20 allows >= 0.20.0, < 1.0.0 and ~> 0.20.1 allows
+			// >= 0.20.1, < 0.21.0
+			parts := len(strings.Split(strings.SplitN(strings.TrimPrefix(m[2], "v"), "-", 2)[0], "."))
+			upper := target
+			upper.prerelease = nil
+			if parts <= 2 {
+				upper.core = [3]int{target.core[0] + 1, 0, 0}
+			} else {
+				upper.core = [3]int{target.core[0], target.core[1] + 1, 0}
+			}
+			match = cmp >= 0 && compareSemver(version, fmt.Sprintf("%d.%d.%d", upper.core[0], upper.core[1], upper.core[2])) < 0
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// steampipeBinDir returns the directory that steampipe is installed to from
+// the configured mirror
+func steampipeBinDir(s *Source) string {
+	return path.Join(homeDir(s), ".steampipe-bin")
+}
+
+// installSteampipe downloads a steampipe release archive from the configured
+// mirror, extracts the steampipe binary, and prepends its directory to PATH
+func installSteampipe(ctx context.Context, s *Source) error {
+	ctx, cancel := context.WithTimeout(ctx, steampipeDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.SteampipeMirror.URL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating steampipe download request: %v", err)
+	}
+	for k, v := range s.SteampipeMirror.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error downloading steampipe: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading steampipe: unexpected status: %d", res.StatusCode)
+	}
+
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return fmt.Errorf("error decompressing steampipe archive: %v", err)
+	}
+	defer gz.Close()
+
+	dir := steampipeBinDir(s)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating steampipe install directory: %v", err)
+	}
+
+	// extract the steampipe binary from the archive
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("steampipe binary not found in archive")
+		}
+		if err != nil {
+			return fmt.Errorf("error reading steampipe archive: %v", err)
+		}
+		if h.Typeflag != tar.TypeReg || path.Base(h.Name) != "steampipe" {
+			continue
+		}
+
+		f, err := os.OpenFile(path.Join(dir, "steampipe"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+		if err != nil {
+			return fmt.Errorf("error creating steampipe binary: %v", err)
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return fmt.Errorf("error writing steampipe binary: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("error writing steampipe binary: %v", err)
+		}
+		break
+	}
+
+	if err := os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH")); err != nil {
+		return fmt.Errorf("error updating PATH: %v", err)
+	}
+	color.Yellow("installed steampipe from mirror: %s", s.SteampipeMirror.URL)
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// warmup executes the configured warm-up queries, discarding their results,
+// in order to pre-populate plugin schemas and caches prior to the operation;
+// failures are logged but otherwise ignored
+func (r *Resource) warmup(ctx context.Context, s *Source) {
+	for _, query := range s.WarmupQueries {
+		start := time.Now()
+		_, stderr, err := r.run(ctx, s, "query", "--output=json", query)
+		if err != nil {
+			color.Red("error executing warm-up query: %v\n%s", err, string(stderr))
+			continue
+		}
+		if s.Debug {
+			color.Yellow("executed warm-up query in %s: %s", time.Since(start), query)
+		}
+	}
+}